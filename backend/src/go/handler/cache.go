@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// historicalMaxAge is how long clients may cache responses for ranges that
+// ended before today. Late syncs can still backfill old days, so this is kept
+// to a day and clients revalidate with the ETag afterwards.
+const historicalMaxAge = 24 * time.Hour
+
+// checkNotModified sets the ETag and Cache-Control headers for a successful
+// GET response and reports whether a 304 was written instead of the body
+func checkNotModified(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	if isHistoricalRange(r, time.Now()) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(historicalMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison If-None-Match calls for
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isHistoricalRange reports whether the request explicitly targets a range
+// whose last day is over in every timezone, so its data is no longer changing.
+// Requests that default to today are never historical.
+func isHistoricalRange(r *http.Request, now time.Time) bool {
+	query := r.URL.Query()
+	end := query.Get("end_date")
+	if end == "" {
+		end = query.Get("date")
+	}
+	return isPastDay(end, now)
+}
+
+// isPastDay reports whether date (YYYY-MM-DD) is over in every timezone. An
+// empty or malformed date is treated as today.
+func isPastDay(date string, now time.Time) bool {
+	day, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return false
+	}
+	// The last timezone to finish a day does so 12 hours after UTC midnight
+	return !now.Before(day.Add(36 * time.Hour))
+}
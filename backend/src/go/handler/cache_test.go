@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"health_app/api/model"
+	"health_app/api/store"
+)
+
+func TestConditionalGet(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	memStore.Steps = []model.TimeSeriesValue{{Time: "08:00", Value: 1200}}
+	h := NewHandler(memStore)
+
+	get := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/steps?"+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleGetStepsSeries(rec, req)
+		return rec
+	}
+
+	first := get("date=2024-03-05", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "private, max-age=86400" {
+		t.Errorf("past date Cache-Control = %q, want private, max-age=86400", got)
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "matching ETag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak match", ifNoneMatch: "W/" + etag, wantStatus: http.StatusNotModified},
+		{name: "one of several", ifNoneMatch: `"stale", ` + etag, wantStatus: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "stale ETag", ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get("date=2024-03-05", tt.ifNoneMatch)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 carried a body: %s", rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("changed data", func(t *testing.T) {
+		memStore.Steps = append(memStore.Steps, model.TimeSeriesValue{Time: "09:00", Value: 300})
+		rec := get("date=2024-03-05", etag)
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Errorf("status = %d with ETag %q, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("today", func(t *testing.T) {
+		if got := get("", "").Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("Cache-Control = %q, want no-cache", got)
+		}
+	})
+}
+
+func TestIsHistoricalRange(t *testing.T) {
+	now := time.Date(2024, 3, 6, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "date=2024-03-04", want: true},
+		{query: "date=2024-03-05", want: false}, // Still Mar 5 in UTC-12 until 12:00 UTC
+		{query: "date=2024-03-06", want: false},
+		{query: "start_date=2024-02-01&end_date=2024-03-04", want: true},
+		{query: "end_date=2024-03-05&date=2024-03-01", want: false},
+		{query: "", want: false},
+		{query: "date=not-a-date", want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		if got := isHistoricalRange(req, now); got != tt.want {
+			t.Errorf("isHistoricalRange(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/?date=2024-03-05", nil)
+	if !isHistoricalRange(req, now.Add(time.Hour)) {
+		t.Error("2024-03-05 should be over everywhere at 12:00 UTC on Mar 6")
+	}
+}
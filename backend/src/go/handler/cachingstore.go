@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"health_app/api/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default cache lifetimes, overridable via QUERY_CACHE_TODAY_TTL and
+// QUERY_CACHE_HISTORICAL_TTL
+const (
+	defaultCacheTodayTTL      = time.Minute
+	defaultCacheHistoricalTTL = 24 * time.Hour
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "query_cache_requests_total",
+	Help: "Cached store reads by method and result (hit or miss).",
+}, []string{"method", "result"})
+
+// CachingStore wraps a Store with an in-memory TTL cache for date-ranged
+// reads. Ranges that end before today are cached for the historical TTL and
+// everything else for the short today TTL. Any write clears the cache, since a
+// late sync can backfill past days. Methods not overridden here pass straight
+// through to the wrapped store.
+type CachingStore struct {
+	Store
+
+	mu            sync.Mutex
+	entries       map[string]cacheEntry
+	generation    uint64 // Bumped by every write so in-flight loads aren't cached
+	lastSweep     time.Time
+	todayTTL      time.Duration
+	historicalTTL time.Duration
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+func NewCachingStore(store Store) *CachingStore {
+	return &CachingStore{
+		Store:         store,
+		entries:       make(map[string]cacheEntry),
+		todayTTL:      loadCacheTTL("QUERY_CACHE_TODAY_TTL", defaultCacheTodayTTL),
+		historicalTTL: loadCacheTTL("QUERY_CACHE_HISTORICAL_TTL", defaultCacheHistoricalTTL),
+	}
+}
+
+// loadCacheTTL reads a positive duration such as "90s" from the environment
+func loadCacheTTL(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", name), slog.String("value", value), slog.Duration("using", def))
+		return def
+	}
+	return d
+}
+
+// cached returns the value stored under method and args, calling load on a
+// miss. Callers get a clone so handlers can convert units in place without
+// corrupting the cached copy. Keys include the user so tenants never share
+// entries, and the tz rendering since it changes the formatted times.
+func cached[T any](c *CachingStore, ctx context.Context, endDate string, clone func(T) T, load func() (T, error), method string, args ...any) (T, error) {
+	key := fmt.Sprintf("%s|%s|%s|%v", method, model.UserIDFromContext(ctx), model.TimezoneFromContext(ctx), args)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		cacheRequests.WithLabelValues(method, "hit").Inc()
+		return clone(entry.value.(T)), nil
+	}
+	cacheRequests.WithLabelValues(method, "miss").Inc()
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	ttl := c.todayTTL
+	if isPastDay(endDate, now) {
+		ttl = c.historicalTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return clone(value), nil
+	}
+	if now.Sub(c.lastSweep) > c.todayTTL {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+	return clone(value), nil
+}
+
+// clear drops every entry after a write
+func (c *CachingStore) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.generation++
+}
+
+func cloneStruct[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	return &clone
+}
+
+func (c *CachingStore) Ingest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	defer c.clear()
+	return c.Store.Ingest(ctx, metrics, precision)
+}
+
+// ValidateIngest writes nothing, so the cache is kept
+func (c *CachingStore) ValidateIngest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	return c.Store.ValidateIngest(ctx, metrics, precision)
+}
+
+func (c *CachingStore) PatchMetric(ctx context.Context, m model.Metric) (*model.PatchResult, error) {
+	defer c.clear()
+	return c.Store.PatchMetric(ctx, m)
+}
+
+func (c *CachingStore) RecomputeDailyTotals(ctx context.Context, date string) error {
+	defer c.clear()
+	return c.Store.RecomputeDailyTotals(ctx, date)
+}
+
+func (c *CachingStore) GetSummary(ctx context.Context, date, source string) (*model.Summary, error) {
+	return cached(c, ctx, date, cloneStruct[model.Summary], func() (*model.Summary, error) {
+		return c.Store.GetSummary(ctx, date, source)
+	}, "GetSummary", date, source)
+}
+
+func (c *CachingStore) GetVitalsHR(ctx context.Context, date string, opts model.HROptions) ([]model.HRBucket, error) {
+	return cached(c, ctx, date, slices.Clone[[]model.HRBucket], func() ([]model.HRBucket, error) {
+		return c.Store.GetVitalsHR(ctx, date, opts)
+	}, "GetVitalsHR", date, opts)
+}
+
+// GetLatestHR is never cached, as the live stream polls it for new readings
+func (c *CachingStore) GetLatestHR(ctx context.Context) (*model.HRBucket, error) {
+	return c.Store.GetLatestHR(ctx)
+}
+
+func (c *CachingStore) GetHRDailyStats(ctx context.Context, startDate, endDate string) ([]model.HRDailyStat, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.HRDailyStat], func() ([]model.HRDailyStat, error) {
+		return c.Store.GetHRDailyStats(ctx, startDate, endDate)
+	}, "GetHRDailyStats", startDate, endDate)
+}
+
+func (c *CachingStore) GetStepsSeries(ctx context.Context, date string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, date, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetStepsSeries(ctx, date)
+	}, "GetStepsSeries", date)
+}
+
+func (c *CachingStore) GetActiveEnergySeries(ctx context.Context, date, source string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, date, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetActiveEnergySeries(ctx, date, source)
+	}, "GetActiveEnergySeries", date, source)
+}
+
+func (c *CachingStore) GetDistanceSeries(ctx context.Context, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetDistanceSeries(ctx, endDate)
+	}, "GetDistanceSeries", endDate)
+}
+
+func (c *CachingStore) GetVitalsBP(ctx context.Context, startDate, endDate string, standard model.BPStandard) ([]model.BloodPressure, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.BloodPressure], func() ([]model.BloodPressure, error) {
+		return c.Store.GetVitalsBP(ctx, startDate, endDate, standard)
+	}, "GetVitalsBP", startDate, endDate, standard)
+}
+
+func (c *CachingStore) GetVitalsGlucose(ctx context.Context, startDate, endDate string) ([]model.Glucose, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.Glucose], func() ([]model.Glucose, error) {
+		return c.Store.GetVitalsGlucose(ctx, startDate, endDate)
+	}, "GetVitalsGlucose", startDate, endDate)
+}
+
+func (c *CachingStore) GetGlucoseDaily(ctx context.Context, startDate, endDate string) ([]model.GlucoseDaily, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.GlucoseDaily], func() ([]model.GlucoseDaily, error) {
+		return c.Store.GetGlucoseDaily(ctx, startDate, endDate)
+	}, "GetGlucoseDaily", startDate, endDate)
+}
+
+func (c *CachingStore) GetGlucoseStats(ctx context.Context, startDate, endDate string, target model.GlucoseRange) (*model.GlucoseStats, error) {
+	return cached(c, ctx, endDate, cloneStruct[model.GlucoseStats], func() (*model.GlucoseStats, error) {
+		return c.Store.GetGlucoseStats(ctx, startDate, endDate, target)
+	}, "GetGlucoseStats", startDate, endDate, target)
+}
+
+func (c *CachingStore) GetVitalsSpo2(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetVitalsSpo2(ctx, startDate, endDate)
+	}, "GetVitalsSpo2", startDate, endDate)
+}
+
+func (c *CachingStore) GetVitalsHRV(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetVitalsHRV(ctx, startDate, endDate)
+	}, "GetVitalsHRV", startDate, endDate)
+}
+
+func (c *CachingStore) GetVitalsRespiratoryRate(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetVitalsRespiratoryRate(ctx, startDate, endDate)
+	}, "GetVitalsRespiratoryRate", startDate, endDate)
+}
+
+func (c *CachingStore) GetBodyTemperature(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetBodyTemperature(ctx, startDate, endDate)
+	}, "GetBodyTemperature", startDate, endDate)
+}
+
+func (c *CachingStore) GetVital(ctx context.Context, metric, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetVital(ctx, metric, startDate, endDate)
+	}, "GetVital", metric, startDate, endDate)
+}
+
+func (c *CachingStore) GetVitalFields(ctx context.Context, metric string, fields []string, startDate, endDate string) (map[string][]model.TimeSeriesValue, error) {
+	clone := func(series map[string][]model.TimeSeriesValue) map[string][]model.TimeSeriesValue {
+		if series == nil {
+			return nil
+		}
+		cloned := make(map[string][]model.TimeSeriesValue, len(series))
+		for field, values := range series {
+			cloned[field] = slices.Clone(values)
+		}
+		return cloned
+	}
+	return cached(c, ctx, endDate, clone, func() (map[string][]model.TimeSeriesValue, error) {
+		return c.Store.GetVitalFields(ctx, metric, fields, startDate, endDate)
+	}, "GetVitalFields", metric, fields, startDate, endDate)
+}
+
+func (c *CachingStore) GetVitalsVO2Max(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetVitalsVO2Max(ctx, startDate, endDate)
+	}, "GetVitalsVO2Max", startDate, endDate)
+}
+
+func (c *CachingStore) GetRestingHR(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetRestingHR(ctx, startDate, endDate)
+	}, "GetRestingHR", startDate, endDate)
+}
+
+func (c *CachingStore) GetSleep(ctx context.Context, startDate, endDate string, interval model.Interval) ([]model.Sleep, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.Sleep], func() ([]model.Sleep, error) {
+		return c.Store.GetSleep(ctx, startDate, endDate, interval)
+	}, "GetSleep", startDate, endDate, interval)
+}
+
+func (c *CachingStore) GetSleepStages(ctx context.Context, date string) ([]model.SleepStageSegment, error) {
+	return cached(c, ctx, date, slices.Clone[[]model.SleepStageSegment], func() ([]model.SleepStageSegment, error) {
+		return c.Store.GetSleepStages(ctx, date)
+	}, "GetSleepStages", date)
+}
+
+func (c *CachingStore) GetWorkouts(ctx context.Context, startDate, date, workoutType string, page model.Pagination) (*model.WorkoutPage, error) {
+	clone := func(p *model.WorkoutPage) *model.WorkoutPage {
+		p = cloneStruct(p)
+		if p != nil {
+			p.Workouts = slices.Clone(p.Workouts)
+		}
+		return p
+	}
+	return cached(c, ctx, date, clone, func() (*model.WorkoutPage, error) {
+		return c.Store.GetWorkouts(ctx, startDate, date, workoutType, page)
+	}, "GetWorkouts", startDate, date, workoutType, page)
+}
+
+func (c *CachingStore) GetWorkoutWeeklyVolume(ctx context.Context, endDate string) ([]model.WorkoutWeek, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.WorkoutWeek], func() ([]model.WorkoutWeek, error) {
+		return c.Store.GetWorkoutWeeklyVolume(ctx, endDate)
+	}, "GetWorkoutWeeklyVolume", endDate)
+}
+
+func (c *CachingStore) GetDatesWithData(ctx context.Context, measurement string, start, end time.Time) ([]string, error) {
+	endDate := end.Format("2006-01-02")
+	return cached(c, ctx, endDate, slices.Clone[[]string], func() ([]string, error) {
+		return c.Store.GetDatesWithData(ctx, measurement, start, end)
+	}, "GetDatesWithData", measurement, start.Format("2006-01-02"), endDate)
+}
+
+// GetWorkoutDetail is cached for the today TTL only, as there's no date to
+// tell whether the workout is still being synced
+func (c *CachingStore) GetWorkoutDetail(ctx context.Context, workoutID string, zones model.HRZones) (*model.WorkoutDetail, error) {
+	clone := func(d *model.WorkoutDetail) *model.WorkoutDetail {
+		d = cloneStruct(d)
+		if d != nil {
+			d.HeartRate = slices.Clone(d.HeartRate)
+			d.Zones = slices.Clone(d.Zones)
+		}
+		return d
+	}
+	return cached(c, ctx, "", clone, func() (*model.WorkoutDetail, error) {
+		return c.Store.GetWorkoutDetail(ctx, workoutID, zones)
+	}, "GetWorkoutDetail", workoutID, zones.MaxHR, zones.Bounds)
+}
+
+func (c *CachingStore) GetDietaryTrends(ctx context.Context, startDate, endDate string, window int) ([]model.DietaryTrend, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.DietaryTrend], func() ([]model.DietaryTrend, error) {
+		return c.Store.GetDietaryTrends(ctx, startDate, endDate, window)
+	}, "GetDietaryTrends", startDate, endDate, window)
+}
+
+func (c *CachingStore) GetDietaryTotals(ctx context.Context, date string) (*model.DietaryTotals, error) {
+	return cached(c, ctx, date, cloneStruct[model.DietaryTotals], func() (*model.DietaryTotals, error) {
+		return c.Store.GetDietaryTotals(ctx, date)
+	}, "GetDietaryTotals", date)
+}
+
+func (c *CachingStore) GetMacroBreakdown(ctx context.Context, date string) (*model.MacroBreakdown, error) {
+	return cached(c, ctx, date, cloneStruct[model.MacroBreakdown], func() (*model.MacroBreakdown, error) {
+		return c.Store.GetMacroBreakdown(ctx, date)
+	}, "GetMacroBreakdown", date)
+}
+
+func (c *CachingStore) GetDietaryMealsToday(ctx context.Context, date string) ([]model.Meal, error) {
+	return cached(c, ctx, date, slices.Clone[[]model.Meal], func() ([]model.Meal, error) {
+		return c.Store.GetDietaryMealsToday(ctx, date)
+	}, "GetDietaryMealsToday", date)
+}
+
+func (c *CachingStore) GetBodyComposition(ctx context.Context, startDate, endDate string) ([]model.BodyComposition, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.BodyComposition], func() ([]model.BodyComposition, error) {
+		return c.Store.GetBodyComposition(ctx, startDate, endDate)
+	}, "GetBodyComposition", startDate, endDate)
+}
+
+func (c *CachingStore) GetWeight(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetWeight(ctx, startDate, endDate)
+	}, "GetWeight", startDate, endDate)
+}
+
+func (c *CachingStore) GetBodyFat(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return cached(c, ctx, endDate, slices.Clone[[]model.TimeSeriesValue], func() ([]model.TimeSeriesValue, error) {
+		return c.Store.GetBodyFat(ctx, startDate, endDate)
+	}, "GetBodyFat", startDate, endDate)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wantsCSV reports whether the client asked for CSV via the Accept header
+func wantsCSV(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(accept), ";")
+		if mediaType == "text/csv" {
+			return true
+		}
+	}
+	return false
+}
+
+// respondWithData writes rows as CSV when the client accepts it, and as JSON otherwise
+func respondWithData(w http.ResponseWriter, r *http.Request, code int, rows interface{}) {
+	if wantsCSV(r) {
+		respondWithCSV(w, code, rows)
+		return
+	}
+	respondWithJSON(w, r, code, rows)
+}
+
+// respondWithCSV serializes a slice of structs as CSV, using each field's JSON
+// tag as its column header
+func respondWithCSV(w http.ResponseWriter, code int, rows interface{}) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		respondWithError(w, http.StatusNotAcceptable, "CSV is only available for list responses")
+		return
+	}
+
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		respondWithError(w, http.StatusNotAcceptable, "CSV is only available for list responses")
+		return
+	}
+
+	columns, header := csvColumns(elemType)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(code)
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		record := make([]string, len(columns))
+		if row.IsValid() {
+			for j, idx := range columns {
+				record[j] = csvValue(row.Field(idx))
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+}
+
+// csvColumns returns the exported field indices of t and their JSON names
+func csvColumns(t reflect.Type) ([]int, []string) {
+	var columns []int
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		columns = append(columns, i)
+		header = append(header, name)
+	}
+	return columns, header
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"health_app/api/model"
+)
+
+func TestWantsCSV(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "text/csv", want: true},
+		{accept: "application/json, text/csv;q=0.9", want: true},
+		{accept: "application/json", want: false},
+		{accept: "", want: false},
+		{accept: "text/csvx", want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := wantsCSV(req); got != tt.want {
+			t.Errorf("wantsCSV(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestRespondWithData(t *testing.T) {
+	minHR := 58.0
+	type bucket struct {
+		Time  string   `json:"time"`
+		Value float64  `json:"value"`
+		Min   *float64 `json:"min"`
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		rows     interface{}
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{
+			name:     "nil pointer fields are empty",
+			accept:   "text/csv",
+			rows:     []bucket{{Time: "08:00", Value: 62.5, Min: &minHR}, {Time: "08:10", Value: 64}},
+			wantCode: http.StatusOK,
+			wantType: "text/csv",
+			wantBody: "time,value,min\n08:00,62.5,58\n08:10,64,\n",
+		},
+		{
+			name:     "columns follow JSON tags",
+			accept:   "text/csv",
+			rows:     []model.Sleep{{Date: "2024-03-05", TotalDuration: 7.5, Awake: 0.5, Efficiency: 93.3}},
+			wantCode: http.StatusOK,
+			wantType: "text/csv",
+			wantBody: "date,totalDuration,deepSleep,remSleep,lightSleep,awake,efficiency,nights\n2024-03-05,7.5,0,0,0,0.5,93.3,0\n",
+		},
+		{
+			name:     "JSON without the Accept header",
+			rows:     []model.TimeSeriesValue{{Time: "08:00", Value: 62}},
+			wantCode: http.StatusOK,
+			wantType: "application/json",
+			wantBody: `[{"time":"08:00","value":62}]`,
+		},
+		{
+			name:     "non-list responses can't be CSV",
+			accept:   "text/csv",
+			rows:     model.Summary{Steps: 8421},
+			wantCode: http.StatusNotAcceptable,
+			wantType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			respondWithData(rec, req, http.StatusOK, tt.rows)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := rec.Body.String(); tt.wantBody != "" && got != tt.wantBody {
+				t.Errorf("body =\n%s\nwant\n%s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,171 +1,1452 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"health_app/api/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/sync/errgroup"
 )
 
+const dateLayout = "2006-01-02"
+
+// defaultSource is the device whose daily totals feed the summary when no source is requested
+const defaultSource = "RingConn"
+
 type Store interface {
-	Ingest(metrics []model.Metric) error
-	GetSummary(date string) (*model.Summary, error)
-	GetVitalsHR(date string) ([]model.TimeSeriesValue, error)
-	GetVitalsBP(endDate string) ([]model.BloodPressure, error)
-	GetVitalsGlucose(endDate string) ([]model.Glucose, error)
-	GetSleep(endDate string) ([]model.Sleep, error)
-	GetWorkouts(date string) ([]model.Workout, error)
-	GetDietaryTrends(endDate string) ([]model.DietaryTrend, error)
-	GetDietaryMealsToday(date string) ([]model.Meal, error)
-	GetBodyComposition(endDate string) ([]model.BodyComposition, error)
+	Ping(ctx context.Context) error
+	Ingest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error)
+	ValidateIngest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error)
+	PatchMetric(ctx context.Context, m model.Metric) (*model.PatchResult, error)
+	RecomputeDailyTotals(ctx context.Context, date string) error
+	GetSummary(ctx context.Context, date, source string) (*model.Summary, error)
+	GetSources(ctx context.Context) ([]string, error)
+	GetMeasurements(ctx context.Context) ([]string, error)
+	GetDatesWithData(ctx context.Context, measurement string, start, end time.Time) ([]string, error)
+	GetLastIngestTime(ctx context.Context) (*model.SyncStatus, error)
+	GetVitalsHR(ctx context.Context, date string, opts model.HROptions) ([]model.HRBucket, error)
+	GetLatestHR(ctx context.Context) (*model.HRBucket, error)
+	GetHRDailyStats(ctx context.Context, startDate, endDate string) ([]model.HRDailyStat, error)
+	GetStepsSeries(ctx context.Context, date string) ([]model.TimeSeriesValue, error)
+	GetActiveEnergySeries(ctx context.Context, date, source string) ([]model.TimeSeriesValue, error)
+	GetDistanceSeries(ctx context.Context, endDate string) ([]model.TimeSeriesValue, error)
+	GetVitalsBP(ctx context.Context, startDate, endDate string, standard model.BPStandard) ([]model.BloodPressure, error)
+	GetVitalsGlucose(ctx context.Context, startDate, endDate string) ([]model.Glucose, error)
+	GetGlucoseDaily(ctx context.Context, startDate, endDate string) ([]model.GlucoseDaily, error)
+	GetGlucoseStats(ctx context.Context, startDate, endDate string, target model.GlucoseRange) (*model.GlucoseStats, error)
+	GetVitalsSpo2(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetVitalsHRV(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetVitalsRespiratoryRate(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetVitalsVO2Max(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetBodyTemperature(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetVital(ctx context.Context, metric, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetVitalFields(ctx context.Context, metric string, fields []string, startDate, endDate string) (map[string][]model.TimeSeriesValue, error)
+	GetRestingHR(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetSleep(ctx context.Context, startDate, endDate string, interval model.Interval) ([]model.Sleep, error)
+	GetSleepStages(ctx context.Context, date string) ([]model.SleepStageSegment, error)
+	GetWorkouts(ctx context.Context, startDate, date, workoutType string, page model.Pagination) (*model.WorkoutPage, error)
+	ListRange(ctx context.Context, list model.ListKind, startDate, endDate string) model.ListMeta
+	GetWorkoutTypes(ctx context.Context) ([]string, error)
+	GetWorkoutWeeklyVolume(ctx context.Context, endDate string) ([]model.WorkoutWeek, error)
+	GetWorkoutDetail(ctx context.Context, workoutID string, zones model.HRZones) (*model.WorkoutDetail, error)
+	GetDietaryTrends(ctx context.Context, startDate, endDate string, window int) ([]model.DietaryTrend, error)
+	GetDietaryTotals(ctx context.Context, date string) (*model.DietaryTotals, error)
+	GetMacroBreakdown(ctx context.Context, date string) (*model.MacroBreakdown, error)
+	GetDietaryMealsToday(ctx context.Context, date string) ([]model.Meal, error)
+	GetBodyComposition(ctx context.Context, startDate, endDate string) ([]model.BodyComposition, error)
+	GetWeight(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
+	GetBodyFat(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error)
 }
 
+// defaultMaxIngestBytes caps ingest request bodies unless INGEST_MAX_BODY_BYTES is set
+const defaultMaxIngestBytes = 5 << 20
+
+// defaultMaxIngestStreamBytes caps NDJSON ingest bodies, which are streamed
+// rather than held in memory, unless INGEST_MAX_STREAM_BYTES is set
+const defaultMaxIngestStreamBytes = 1 << 30
+
+// defaultIngestBatchSize is how many streamed metrics are buffered before each
+// write unless INGEST_BATCH_SIZE is set
+const defaultIngestBatchSize = 5000
+
 type Handler struct {
 	store Store
+	// exposeErrors returns raw store errors to clients; only enabled in development
+	exposeErrors    bool
+	maxIngestBytes  int64
+	maxStreamBytes  int64
+	ingestBatchSize int
+	valueRanges     map[string]valueRange // nil disables the ingest sanity check
+	liveHRInterval  time.Duration
+	hrZones         model.HRZones // MaxHR is 0 unless HR_MAX is set
+	streamsDone     chan struct{} // Closed by StopStreams
+	stopStreams     sync.Once
 }
 
 func NewHandler(store Store) *Handler {
-	return &Handler{store: store}
+	return &Handler{
+		store:           store,
+		exposeErrors:    os.Getenv("APP_ENV") == "development",
+		maxIngestBytes:  loadMaxIngestBytes(),
+		maxStreamBytes:  loadMaxIngestStreamBytes(),
+		ingestBatchSize: loadIngestBatchSize(),
+		valueRanges:     loadValueRanges(),
+		liveHRInterval:  loadLiveHRInterval(),
+		hrZones:         loadHRZones(),
+		streamsDone:     make(chan struct{}),
+	}
+}
+
+// loadMaxIngestBytes reads INGEST_MAX_BODY_BYTES, falling back to the default
+func loadMaxIngestBytes() int64 {
+	value := os.Getenv("INGEST_MAX_BODY_BYTES")
+	if value == "" {
+		return defaultMaxIngestBytes
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INGEST_MAX_BODY_BYTES"), slog.String("value", value), slog.Int64("using", defaultMaxIngestBytes))
+		return defaultMaxIngestBytes
+	}
+	return n
+}
+
+// loadMaxIngestStreamBytes reads INGEST_MAX_STREAM_BYTES, falling back to the
+// default
+func loadMaxIngestStreamBytes() int64 {
+	value := os.Getenv("INGEST_MAX_STREAM_BYTES")
+	if value == "" {
+		return defaultMaxIngestStreamBytes
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INGEST_MAX_STREAM_BYTES"), slog.String("value", value), slog.Int64("using", defaultMaxIngestStreamBytes))
+		return defaultMaxIngestStreamBytes
+	}
+	return n
 }
 
+// loadIngestBatchSize reads INGEST_BATCH_SIZE, falling back to the default
+func loadIngestBatchSize() int {
+	value := os.Getenv("INGEST_BATCH_SIZE")
+	if value == "" {
+		return defaultIngestBatchSize
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INGEST_BATCH_SIZE"), slog.String("value", value), slog.Int("using", defaultIngestBatchSize))
+		return defaultIngestBatchSize
+	}
+	return n
+}
+
+// HandleNotFound replaces chi's plain-text 404 so every error is JSON
+func (h *Handler) HandleNotFound(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, http.StatusNotFound, "not found")
+}
+
+// HandleMethodNotAllowed replaces chi's plain-text 405 so every error is JSON
+func (h *Handler) HandleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// HandleHealthz reports whether the store is reachable, returning 503 until it is
+func (h *Handler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.Ping(r.Context()); err != nil {
+		logError(r, err)
+		message := "store unavailable"
+		if h.exposeErrors {
+			message = err.Error()
+		}
+		respondWithError(w, http.StatusServiceUnavailable, message)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleIngest writes a batch of metrics. With dry_run=true the batch is
+// validated and encoded but nothing is written.
 func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
+	if isNDJSONContentType(r) {
+		h.handleIngestNDJSON(w, r)
+		return
+	}
+	if !isJSONContentType(r) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json or application/x-ndjson")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxIngestBytes)
+
 	var req model.IngestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logError(r, err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.Metrics) == 0 {
+		respondWithError(w, http.StatusBadRequest, "metrics must contain at least one metric")
+		return
+	}
+	precision, err := validatePrecision(req.Precision)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := h.store.Ingest(req.Metrics); err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userID := model.UserIDFromContext(r.Context())
+	if invalid := validateMetrics(req.Metrics, userID); len(invalid) > 0 {
+		respondWithJSON(w, r, http.StatusBadRequest, model.IngestValidationError{
+			Error:   fmt.Sprintf("%d of %d metrics are invalid", len(invalid), len(req.Metrics)),
+			Metrics: invalid,
+		})
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	// Implausible values are dropped and reported rather than failing the batch
+	metrics, rejected := h.filterValueRanges(req.Metrics)
+	tagUserID(metrics, userID)
+
+	dryRun := isDryRun(r)
+	ingest := h.store.Ingest
+	if dryRun {
+		ingest = h.store.ValidateIngest
+	}
+	result := &model.IngestResult{DryRun: dryRun}
+	if len(metrics) > 0 {
+		result, err = ingest(r.Context(), metrics, precision)
+		if err != nil {
+			h.respondWithInternalError(w, r, err)
+			return
+		}
+	}
+	result.Rejected = rejected
+	result.Skipped += len(rejected)
+
+	status := http.StatusAccepted
+	if dryRun {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, r, status, result)
+}
+
+// HandlePatchMetric overwrites fields of a single existing point. The body is
+// a Metric whose measurement, full tag set and timestamp identify the point.
+func (h *Handler) HandlePatchMetric(w http.ResponseWriter, r *http.Request) {
+	var metric model.Metric
+	if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if metric.Timestamp.IsZero() {
+		respondWithError(w, http.StatusBadRequest, "timestamp is required to identify the point")
+		return
+	}
+	if len(metric.Tags) == 0 {
+		respondWithError(w, http.StatusBadRequest, "tags are required to identify the point")
+		return
+	}
+	if len(metric.Fields) == 0 {
+		respondWithError(w, http.StatusBadRequest, "at least one field is required")
+		return
+	}
+
+	userID := model.UserIDFromContext(r.Context())
+	if invalid := validateMetrics([]model.Metric{metric}, userID); len(invalid) > 0 {
+		respondWithError(w, http.StatusBadRequest, invalid[0].Reason)
+		return
+	}
+	if reason := h.checkValueRange(metric); reason != "" {
+		respondWithError(w, http.StatusBadRequest, reason)
+		return
+	}
+	// Only the caller's own points can be targeted
+	tagUserID([]model.Metric{metric}, userID)
+
+	result, err := h.store.PatchMetric(r.Context(), metric)
+	if errors.Is(err, model.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("no %s point with those tags at %s", metric.Measurement, metric.Timestamp.Format(time.RFC3339Nano)))
+		return
+	}
+	if errors.Is(err, model.ErrInvalidPatch) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, result)
+}
+
+// HandleRecomputeDailyTotals rebuilds a day's daily_totals from the raw
+// measurements
+func (h *Handler) HandleRecomputeDailyTotals(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.store.RecomputeDailyTotals(r.Context(), date); err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isJSONContentType reports whether the request body is declared as JSON,
+// ignoring parameters such as charset
+func isJSONContentType(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// isDryRun reports whether an ingest should be validated without writing
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+// validatePrecision checks an ingest timestamp precision, defaulting to ns
+func validatePrecision(precision model.Precision) (model.Precision, error) {
+	switch precision {
+	case "":
+		return model.PrecisionNanosecond, nil
+	case model.PrecisionSecond, model.PrecisionMillisecond, model.PrecisionMicrosecond, model.PrecisionNanosecond:
+		return precision, nil
+	default:
+		return "", fmt.Errorf("invalid precision %q: must be s, ms, us or ns", precision)
+	}
+}
+
+// tagUserID stamps every metric with the authenticated user so points are
+// always written under that user
+func tagUserID(metrics []model.Metric, userID string) {
+	if userID == "" {
+		return
+	}
+	for i := range metrics {
+		if metrics[i].Tags == nil {
+			metrics[i].Tags = make(map[string]string)
+		}
+		metrics[i].Tags[model.UserIDTag] = userID
+	}
+}
+
+// validateMetrics checks each metric can be written as line protocol and
+// returns one entry per rejected metric index. A user_id tag, if present, must
+// match the authenticated user.
+func validateMetrics(metrics []model.Metric, userID string) []model.MetricError {
+	var invalid []model.MetricError
+	for i, m := range metrics {
+		reason := validateMetric(m)
+		if tagged, ok := m.Tags[model.UserIDTag]; ok && userID != "" && reason == "" && tagged != userID {
+			reason = fmt.Sprintf("tag %q does not match the authenticated user", model.UserIDTag)
+		}
+		if reason != "" {
+			invalid = append(invalid, model.MetricError{Index: i, Reason: reason})
+		}
+	}
+	return invalid
+}
+
+func validateMetric(m model.Metric) string {
+	if strings.TrimSpace(m.Measurement) == "" {
+		return "measurement is required"
+	}
+	if strings.HasPrefix(m.Measurement, "_") {
+		return fmt.Sprintf("measurement %q must not start with an underscore", m.Measurement)
+	}
+	if hasReservedChars(m.Measurement) {
+		return fmt.Sprintf("measurement %q contains reserved characters", m.Measurement)
+	}
+	for k, v := range m.Tags {
+		if k == "" || hasReservedChars(k) || hasReservedChars(v) {
+			return fmt.Sprintf("tag %q is empty or contains reserved characters", k)
+		}
+	}
+	if len(m.Fields) == 0 {
+		return "at least one field is required"
+	}
+	for k, v := range m.Fields {
+		if k == "" || hasReservedChars(k) {
+			return fmt.Sprintf("field %q is empty or contains reserved characters", k)
+		}
+		if v == nil {
+			return fmt.Sprintf("field %q has no value", k)
+		}
+	}
+	for k, fieldType := range m.FieldTypes {
+		v, ok := m.Fields[k]
+		if !ok {
+			return fmt.Sprintf("field type given for unknown field %q", k)
+		}
+		number, isNumber := v.(float64)
+		switch fieldType {
+		case model.FieldTypeFloat:
+			if !isNumber {
+				return fmt.Sprintf("field %q is typed float but is not a number", k)
+			}
+		case model.FieldTypeInteger:
+			if !isNumber || number != math.Trunc(number) || math.Abs(number) > 1<<53 {
+				return fmt.Sprintf("field %q is typed integer but is not a whole number", k)
+			}
+		default:
+			return fmt.Sprintf("field %q has unknown type %q: must be float or integer", k, fieldType)
+		}
+	}
+	return ""
+}
+
+// hasReservedChars reports characters that line protocol cannot escape
+func hasReservedChars(s string) bool {
+	return strings.ContainsAny(s, "\n\r")
 }
 
 func (h *Handler) HandleGetSummary(w http.ResponseWriter, r *http.Request) {
-	date := getDateQueryParam(r)
-	log.Printf("Received request to comput summary data for %s", date)
-	summary, err := h.store.GetSummary(date)
+	date, err := getDateQueryParam(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, summary)
+	slog.DebugContext(r.Context(), "computing summary", slog.String("date", date))
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = defaultSource
+	}
+	summary, err := h.store.GetSummary(r.Context(), date, source)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, summary)
+}
+
+func (h *Handler) HandleGetDashboard(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = defaultSource
+	}
+
+	ctx := r.Context()
+	dashboard := model.Dashboard{Date: date}
+
+	var mu sync.Mutex
+	errs := make(map[string]string)
+	// section runs one panel's query; a failure is recorded against that panel
+	// rather than failing the whole dashboard
+	section := func(name string, load func() error) func() error {
+		return func() error {
+			if err := load(); err != nil {
+				logError(r, fmt.Errorf("dashboard %s: %w", name, err))
+				message := "failed to load"
+				if h.exposeErrors {
+					message = err.Error()
+				}
+				mu.Lock()
+				errs[name] = message
+				mu.Unlock()
+			}
+			return nil
+		}
+	}
+
+	var g errgroup.Group
+	g.Go(section("summary", func() (err error) {
+		dashboard.Summary, err = h.store.GetSummary(ctx, date, source)
+		return err
+	}))
+	g.Go(section("heartRate", func() (err error) {
+		dashboard.HeartRate, err = h.store.GetVitalsHR(ctx, date, model.HROptions{})
+		return err
+	}))
+	g.Go(section("bloodPressure", func() (err error) {
+		dashboard.BloodPressure, err = h.store.GetVitalsBP(ctx, "", date, model.BPStandardACCAHA)
+		return err
+	}))
+	g.Go(section("glucose", func() (err error) {
+		dashboard.Glucose, err = h.store.GetVitalsGlucose(ctx, "", date)
+		return err
+	}))
+	g.Go(section("sleep", func() (err error) {
+		dashboard.Sleep, err = h.store.GetSleep(ctx, "", date, model.IntervalDay)
+		return err
+	}))
+	g.Go(section("workouts", func() error {
+		page, err := h.store.GetWorkouts(ctx, "", date, "", model.Pagination{})
+		if err == nil {
+			dashboard.Workouts = page.Workouts
+		}
+		return err
+	}))
+	g.Go(section("dietaryTrends", func() (err error) {
+		dashboard.DietaryTrends, err = h.store.GetDietaryTrends(ctx, "", date, model.DefaultTrendWindow)
+		return err
+	}))
+	g.Go(section("meals", func() (err error) {
+		dashboard.Meals, err = h.store.GetDietaryMealsToday(ctx, date)
+		return err
+	}))
+	g.Go(section("bodyComposition", func() (err error) {
+		dashboard.BodyComposition, err = h.store.GetBodyComposition(ctx, "", date)
+		return err
+	}))
+	g.Wait()
+
+	if len(errs) > 0 {
+		dashboard.Errors = errs
+	}
+	respondWithJSON(w, r, http.StatusOK, dashboard)
+}
+
+func (h *Handler) HandleGetSources(w http.ResponseWriter, r *http.Request) {
+	sources, err := h.store.GetSources(r.Context())
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, sources)
+}
+
+func (h *Handler) HandleGetMeasurements(w http.ResponseWriter, r *http.Request) {
+	measurements, err := h.store.GetMeasurements(r.Context())
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, measurements)
+}
+
+// maxCalendarDays bounds the range /calendar/{measurement} scans
+const maxCalendarDays = 366
+
+// validMeasurementName reports whether measurement can be quoted into a query
+func validMeasurementName(measurement string) bool {
+	return strings.TrimSpace(measurement) != "" && !strings.ContainsAny(measurement, "\"\\")
+}
+
+// HandleGetDatesWithData lists the days with data for a measurement, for
+// calendar pickers. The range defaults to the month of end_date.
+func (h *Handler) HandleGetDatesWithData(w http.ResponseWriter, r *http.Request) {
+	measurement := chi.URLParam(r, "measurement")
+	if !validMeasurementName(measurement) {
+		respondWithError(w, http.StatusBadRequest, "a valid measurement is required")
+		return
+	}
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	end, _ := time.Parse(dateLayout, endDate)
+	start := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if startDate != "" {
+		start, _ = time.Parse(dateLayout, startDate)
+	}
+	if days := int(end.Sub(start).Hours()/24) + 1; days > maxCalendarDays {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("range covers %d days; at most %d are allowed", days, maxCalendarDays))
+		return
+	}
+
+	dates, err := h.store.GetDatesWithData(r.Context(), measurement, start, end)
+	if errors.Is(err, model.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("measurement %q not found", measurement))
+		return
+	}
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, dates)
+}
+
+// HandleGetLastSync reports when each measurement last received data so a
+// stalled sync can be spotted
+func (h *Handler) HandleGetLastSync(w http.ResponseWriter, r *http.Request) {
+	status, err := h.store.GetLastIngestTime(r.Context())
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, status)
 }
 
 func (h *Handler) HandleGetVitalsHR(w http.ResponseWriter, r *http.Request) {
-	date := getDateQueryParam(r)
-	hr, err := h.store.GetVitalsHR(date)
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket, err := getBucketQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Selected fields (e.g. min,max bands) come back as raw series per field
+	if fields := getFieldsQueryParam(r); len(fields) > 0 {
+		h.handleGetVitalFields(w, r, "hr", fields, date, date)
+		return
+	}
+	maxPoints, err := getMaxPointsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := model.HROptions{
+		Raw:       r.URL.Query().Get("raw") == "true",
+		Bucket:    bucket,
+		MaxPoints: maxPoints,
+	}
+	hr, err := h.store.GetVitalsHR(r.Context(), date, opts)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, hr)
+}
+
+func (h *Handler) HandleGetHRDailyStats(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats, err := h.store.GetHRDailyStats(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, stats)
+}
+
+func (h *Handler) HandleGetStepsSeries(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	steps, err := h.store.GetStepsSeries(r.Context(), date)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, steps)
+}
+
+func (h *Handler) HandleGetActiveEnergySeries(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = defaultSource
+	}
+	energy, err := h.store.GetActiveEnergySeries(r.Context(), date, source)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, energy)
+}
+
+// HandleGetDistanceSeries returns daily distance in km, or miles with
+// units=imperial
+func (h *Handler) HandleGetDistanceSeries(w http.ResponseWriter, r *http.Request) {
+	endDate, err := getEndDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	units, err := getUnitsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	distances, err := h.store.GetDistanceSeries(r.Context(), endDate)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.respondWithInternalError(w, r, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, hr)
+	if units == model.UnitsImperial {
+		for i := range distances {
+			distances[i].Value = model.KmToMiles(distances[i].Value)
+		}
+	}
+	respondWithData(w, r, http.StatusOK, distances)
 }
 
 func (h *Handler) HandleGetVitalsBP(w http.ResponseWriter, r *http.Request) {
-	endDate := getEndDateQueryParam(r)
-	bp, err := h.store.GetVitalsBP(endDate)
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	standard, err := getBPStandardQueryParam(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, bp)
+	bp, err := h.store.GetVitalsBP(r.Context(), startDate, endDate, standard)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	meta := h.store.ListRange(r.Context(), model.ListBloodPressure, startDate, endDate)
+	respondWithList(w, r, http.StatusOK, bp, meta)
 }
 
 func (h *Handler) HandleGetVitalsGlucose(w http.ResponseWriter, r *http.Request) {
-	endDate := getEndDateQueryParam(r)
-	glucose, err := h.store.GetVitalsGlucose(endDate)
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Raw readings stay the default; a CGM produces hundreds a day, so ranges
+	// can ask for one row per day instead
+	meta := h.store.ListRange(r.Context(), model.ListGlucose, startDate, endDate)
+	switch aggregate := r.URL.Query().Get("aggregate"); aggregate {
+	case "", "raw":
+		glucose, err := h.store.GetVitalsGlucose(r.Context(), startDate, endDate)
+		if err != nil {
+			h.respondWithInternalError(w, r, err)
+			return
+		}
+		respondWithList(w, r, http.StatusOK, glucose, meta)
+	case "daily":
+		daily, err := h.store.GetGlucoseDaily(r.Context(), startDate, endDate)
+		if err != nil {
+			h.respondWithInternalError(w, r, err)
+			return
+		}
+		respondWithList(w, r, http.StatusOK, daily, meta)
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid aggregate %q: must be raw or daily", aggregate))
+	}
+}
+
+func (h *Handler) HandleGetGlucoseStats(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	target, err := getGlucoseRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats, err := h.store.GetGlucoseStats(r.Context(), startDate, endDate, target)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, stats)
+}
+
+func (h *Handler) HandleGetVitalsSpo2(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	spo2, err := h.store.GetVitalsSpo2(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, spo2)
+}
+
+func (h *Handler) HandleGetVitalsHRV(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hrv, err := h.store.GetVitalsHRV(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, hrv)
+}
+
+func (h *Handler) HandleGetVitalsRespiratoryRate(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, glucose)
+	rates, err := h.store.GetVitalsRespiratoryRate(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, rates)
+}
+
+// HandleGetVital serves any vital in the store's registry as a time series;
+// the dedicated /vitals routes take precedence for names they share
+func (h *Handler) HandleGetVital(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	metric := chi.URLParam(r, "metric")
+	if fields := getFieldsQueryParam(r); len(fields) > 0 {
+		h.handleGetVitalFields(w, r, metric, fields, startDate, endDate)
+		return
+	}
+	values, err := h.store.GetVital(r.Context(), metric, startDate, endDate)
+	if errors.Is(err, model.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("unknown vital %q", metric))
+		return
+	}
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, values)
+}
+
+// handleGetVitalFields returns a map of field to series for the requested
+// fields of a vital, e.g. fields=min,max for heart rate bands
+func (h *Handler) handleGetVitalFields(w http.ResponseWriter, r *http.Request, metric string, fields []string, startDate, endDate string) {
+	series, err := h.store.GetVitalFields(r.Context(), metric, fields, startDate, endDate)
+	if errors.Is(err, model.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("unknown vital %q", metric))
+		return
+	}
+	if errors.Is(err, model.ErrUnknownField) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, series)
+}
+
+// getFieldsQueryParam returns the distinct names in the comma-separated fields param
+func getFieldsQueryParam(r *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		field = strings.TrimSpace(field)
+		if field != "" && !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// HandleGetBodyTemperature returns temperature in °C, or °F with units=imperial
+func (h *Handler) HandleGetBodyTemperature(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	units, err := getUnitsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	temperatures, err := h.store.GetBodyTemperature(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	if units == model.UnitsImperial {
+		for i := range temperatures {
+			temperatures[i].Value = model.CelsiusToFahrenheit(temperatures[i].Value)
+		}
+	}
+	respondWithData(w, r, http.StatusOK, temperatures)
+}
+
+func (h *Handler) HandleGetVitalsVO2Max(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vo2Max, err := h.store.GetVitalsVO2Max(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, vo2Max)
+}
+
+func (h *Handler) HandleGetRestingHR(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	restingHR, err := h.store.GetRestingHR(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, restingHR)
 }
 
 func (h *Handler) HandleGetSleep(w http.ResponseWriter, r *http.Request) {
-	endDate := getEndDateQueryParam(r)
-	sleep, err := h.store.GetSleep(endDate)
+	startDate, endDate, err := getDateRangeQueryParams(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, sleep)
+	interval, err := getIntervalQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sleep, err := h.store.GetSleep(r.Context(), startDate, endDate, interval)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	meta := h.store.ListRange(r.Context(), sleepListKind(interval), startDate, endDate)
+	respondWithList(w, r, http.StatusOK, sleep, meta)
+}
+
+// HandleGetSleepStages returns the hypnogram for the night ending on date
+func (h *Handler) HandleGetSleepStages(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stages, err := h.store.GetSleepStages(r.Context(), date)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, stages)
 }
 
 func (h *Handler) HandleGetWorkouts(w http.ResponseWriter, r *http.Request) {
-	date := getDateQueryParam(r)
-	workouts, err := h.store.GetWorkouts(date)
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	startDate, err := getStartDateQueryParam(r)
+	if err == nil {
+		err = validateDateOrder(startDate, date)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, paginated, err := getPaginationQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	units, err := getUnitsQueryParam(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, workouts)
+	workoutType := r.URL.Query().Get("type")
+	workouts, err := h.store.GetWorkouts(r.Context(), startDate, date, workoutType, page)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	if units == model.UnitsImperial {
+		for i := range workouts.Workouts {
+			workoutToImperial(&workouts.Workouts[i])
+		}
+	}
+	if wantsEnvelope(r) {
+		meta := h.store.ListRange(r.Context(), model.ListWorkouts, startDate, date)
+		if paginated {
+			meta.Total, meta.Offset = workouts.Total, workouts.Offset
+		}
+		respondWithList(w, r, http.StatusOK, workouts.Workouts, meta)
+		return
+	}
+	// Clients that don't page (and CSV exports) receive the bare list
+	if !paginated || wantsCSV(r) {
+		respondWithData(w, r, http.StatusOK, workouts.Workouts)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, workouts)
+}
+
+func (h *Handler) HandleGetWorkoutDetail(w http.ResponseWriter, r *http.Request) {
+	units, err := getUnitsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	zones, err := h.getHRZonesQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	workoutID := chi.URLParam(r, "id")
+	detail, err := h.store.GetWorkoutDetail(r.Context(), workoutID, zones)
+	if errors.Is(err, model.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("workout %q not found", workoutID))
+		return
+	}
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	if units == model.UnitsImperial {
+		workoutToImperial(&detail.Workout)
+	}
+	respondWithJSON(w, r, http.StatusOK, detail)
+}
+
+// workoutToImperial converts distance to miles and pace to minutes per mile
+func workoutToImperial(workout *model.Workout) {
+	workout.Distance = model.KmToMiles(workout.Distance)
+	workout.Pace *= 1.609344
+}
+
+func (h *Handler) HandleGetWorkoutWeeklyVolume(w http.ResponseWriter, r *http.Request) {
+	endDate, err := getEndDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	weeks, err := h.store.GetWorkoutWeeklyVolume(r.Context(), endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, weeks)
+}
+
+func (h *Handler) HandleGetWorkoutTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.store.GetWorkoutTypes(r.Context())
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, types)
 }
 
 func (h *Handler) HandleGetDietaryTrends(w http.ResponseWriter, r *http.Request) {
-	endDate := getEndDateQueryParam(r)
-	trends, err := h.store.GetDietaryTrends(endDate)
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	window, err := getWindowQueryParam(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, trends)
+	trends, err := h.store.GetDietaryTrends(r.Context(), startDate, endDate, window)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, trends)
+}
+
+func (h *Handler) HandleGetDietaryTotals(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	totals, err := h.store.GetDietaryTotals(r.Context(), date)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, totals)
+}
+
+func (h *Handler) HandleGetMacroBreakdown(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	breakdown, err := h.store.GetMacroBreakdown(r.Context(), date)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithJSON(w, r, http.StatusOK, breakdown)
 }
 
 func (h *Handler) HandleGetDietaryMealsToday(w http.ResponseWriter, r *http.Request) {
-	date := getDateQueryParam(r)
-	meals, err := h.store.GetDietaryMealsToday(date)
+	date, err := getDateQueryParam(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, meals)
+	meals, err := h.store.GetDietaryMealsToday(r.Context(), date)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, meals)
 }
 
 func (h *Handler) HandleGetBodyComposition(w http.ResponseWriter, r *http.Request) {
-	endDate := getEndDateQueryParam(r)
-	bodyComp, err := h.store.GetBodyComposition(endDate)
+	startDate, endDate, err := getDateRangeQueryParams(r)
 	if err != nil {
-		log.Printf("ERROR: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, bodyComp)
+	units, err := getUnitsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bodyComp, err := h.store.GetBodyComposition(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	if units == model.UnitsImperial {
+		for i := range bodyComp {
+			bodyComp[i].Weight = model.KgToLbs(bodyComp[i].Weight)
+			bodyComp[i].MuscleMass = model.KgToLbs(bodyComp[i].MuscleMass)
+			bodyComp[i].TrendWeight = model.KgToLbs(bodyComp[i].TrendWeight)
+		}
+	}
+	respondWithData(w, r, http.StatusOK, bodyComp)
 }
 
-func getDateQueryParam(r *http.Request) string {
+func (h *Handler) HandleGetWeight(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	units, err := getUnitsQueryParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	weights, err := h.store.GetWeight(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	if units == model.UnitsImperial {
+		for i := range weights {
+			weights[i].Value = model.KgToLbs(weights[i].Value)
+		}
+	}
+	respondWithData(w, r, http.StatusOK, weights)
+}
+
+func (h *Handler) HandleGetBodyFat(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := getDateRangeQueryParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bodyFat, err := h.store.GetBodyFat(r.Context(), startDate, endDate)
+	if err != nil {
+		h.respondWithInternalError(w, r, err)
+		return
+	}
+	respondWithData(w, r, http.StatusOK, bodyFat)
+}
+
+func getDateQueryParam(r *http.Request) (string, error) {
 	date := r.URL.Query().Get("date")
 	if date == "" {
-		log.Printf("Date not found...Received url: %s", r.URL)
-		date = time.Now().UTC().Format("2006-01-02")
+		slog.DebugContext(r.Context(), "no date given, using today", slog.String("url", r.URL.String()))
+		return time.Now().UTC().Format(dateLayout), nil
 	}
-	return date
+	return validateDate("date", date)
 }
 
-func getEndDateQueryParam(r *http.Request) string {
+func getEndDateQueryParam(r *http.Request) (string, error) {
 	date := r.URL.Query().Get("end_date")
 	if date == "" {
-		date = time.Now().UTC().Format("2006-01-02")
+		return time.Now().UTC().Format(dateLayout), nil
+	}
+	return validateDate("end_date", date)
+}
+
+// getStartDateQueryParam returns the optional start_date, or an empty string
+// when the caller wants the endpoint's default window
+func getStartDateQueryParam(r *http.Request) (string, error) {
+	date := r.URL.Query().Get("start_date")
+	if date == "" {
+		return "", nil
+	}
+	return validateDate("start_date", date)
+}
+
+// getPaginationQueryParams parses the optional limit and offset params and
+// reports whether either was supplied
+func getPaginationQueryParams(r *http.Request) (model.Pagination, bool, error) {
+	var page model.Pagination
+	query := r.URL.Query()
+	limit, offset := query.Get("limit"), query.Get("offset")
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return page, false, fmt.Errorf("invalid limit %q: must be a non-negative integer", limit)
+		}
+		page.Limit = n
+	}
+	if offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return page, false, fmt.Errorf("invalid offset %q: must be a non-negative integer", offset)
+		}
+		page.Offset = n
+	}
+
+	return page, limit != "" || offset != "", nil
+}
+
+// getWindowQueryParam parses the optional rolling-average window in days
+func getWindowQueryParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("window")
+	if value == "" {
+		return model.DefaultTrendWindow, nil
+	}
+	window, err := strconv.Atoi(value)
+	if err != nil || window < 2 || window > 30 {
+		return 0, fmt.Errorf("invalid window %q: must be between 2 and 30 days", value)
+	}
+	return window, nil
+}
+
+// getGlucoseRangeQueryParams parses the optional low and high target bounds
+// in mg/dL, defaulting each to model.DefaultGlucoseRange
+func getGlucoseRangeQueryParams(r *http.Request) (model.GlucoseRange, error) {
+	target := model.DefaultGlucoseRange
+	query := r.URL.Query()
+	for _, bound := range []struct {
+		param string
+		value *float64
+	}{
+		{"low", &target.Low},
+		{"high", &target.High},
+	} {
+		raw := query.Get(bound.param)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(n) || n <= 0 || math.IsInf(n, 0) {
+			return target, fmt.Errorf("invalid %s %q: must be a positive number in mg/dL", bound.param, raw)
+		}
+		*bound.value = n
+	}
+	if target.Low >= target.High {
+		return target, fmt.Errorf("invalid range: low (%g) must be below high (%g)", target.Low, target.High)
+	}
+	return target, nil
+}
+
+// getIntervalQueryParam parses the optional interval param, defaulting to day
+func getIntervalQueryParam(r *http.Request) (model.Interval, error) {
+	switch interval := model.Interval(r.URL.Query().Get("interval")); interval {
+	case "", model.IntervalDay:
+		return model.IntervalDay, nil
+	case model.IntervalWeek, model.IntervalMonth:
+		return interval, nil
+	default:
+		return "", fmt.Errorf("invalid interval %q: must be day, week or month", interval)
+	}
+}
+
+// getBPStandardQueryParam parses the optional standard param, defaulting to ACC/AHA
+func getBPStandardQueryParam(r *http.Request) (model.BPStandard, error) {
+	switch standard := model.BPStandard(strings.ToLower(r.URL.Query().Get("standard"))); standard {
+	case "", model.BPStandardACCAHA:
+		return model.BPStandardACCAHA, nil
+	case model.BPStandardESC, model.BPStandardJNC7:
+		return standard, nil
+	default:
+		return "", fmt.Errorf("invalid standard %q: must be acc_aha, esc or jnc7", standard)
+	}
+}
+
+// getUnitsQueryParam parses the optional units param; values are stored metric
+func getUnitsQueryParam(r *http.Request) (model.Units, error) {
+	switch units := model.Units(r.URL.Query().Get("units")); units {
+	case "", model.UnitsMetric:
+		return model.UnitsMetric, nil
+	case model.UnitsImperial:
+		return units, nil
+	default:
+		return "", fmt.Errorf("invalid units %q: must be metric or imperial", units)
+	}
+}
+
+// getBucketQueryParam parses the optional bucket duration (e.g. 5m, 1h),
+// defaulting when absent and rejecting anything unparseable or under 1m
+func getBucketQueryParam(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("bucket")
+	if value == "" {
+		return model.DefaultHRBucket, nil
+	}
+	bucket, err := time.ParseDuration(value)
+	if err != nil || bucket < time.Minute {
+		return 0, fmt.Errorf("invalid bucket %q: must be a duration of at least 1m, e.g. 30m", value)
 	}
-	return date
+	return bucket, nil
 }
 
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, _ := json.Marshal(payload)
+// getMaxPointsQueryParam parses the optional max_points cap; zero means none
+func getMaxPointsQueryParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("max_points")
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid max_points %q: must be a positive integer", value)
+	}
+	return n, nil
+}
+
+// getDateRangeQueryParams returns start_date and end_date, rejecting a start
+// after the end
+func getDateRangeQueryParams(r *http.Request) (string, string, error) {
+	endDate, err := getEndDateQueryParam(r)
+	if err != nil {
+		return "", "", err
+	}
+	startDate, err := getStartDateQueryParam(r)
+	if err != nil {
+		return "", "", err
+	}
+	if err := validateDateOrder(startDate, endDate); err != nil {
+		return "", "", err
+	}
+	return startDate, endDate, nil
+}
+
+// validateDateOrder rejects a range whose optional start is after its end
+func validateDateOrder(startDate, endDate string) error {
+	// YYYY-MM-DD strings order the same as the dates they name
+	if startDate != "" && startDate > endDate {
+		return fmt.Errorf("start_date %s is after end date %s", startDate, endDate)
+	}
+	return nil
+}
+
+// validateDate ensures a query parameter is a plain YYYY-MM-DD date so it
+// can never carry anything else through to the store, and that it isn't in
+// the future. "Today" is taken in the furthest-ahead timezone (UTC+14) so a
+// client's local date is never rejected.
+func validateDate(param, value string) (string, error) {
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		return "", fmt.Errorf("invalid %s %q: expected format YYYY-MM-DD", param, value)
+	}
+	if latest := time.Now().UTC().Add(14 * time.Hour).Format(dateLayout); value > latest {
+		return "", fmt.Errorf("invalid %s %s: date is in the future", param, value)
+	}
+	return value, nil
+}
+
+// logError emits a structured error log carrying the request ID, route and
+// any date parameters so a failed request can be traced to its log line
+func logError(r *http.Request, err error) {
+	attrs := []any{
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+		slog.String("route", RoutePattern(r)),
+		slog.String("path", r.URL.Path),
+		slog.String("method", r.Method),
+	}
+	query := r.URL.Query()
+	for _, param := range []string{"date", "start_date", "end_date"} {
+		if v := query.Get(param); v != "" {
+			attrs = append(attrs, slog.String(param, v))
+		}
+	}
+	attrs = append(attrs, slog.Any("error", err))
+	slog.ErrorContext(r.Context(), "request failed", attrs...)
+}
+
+// RoutePattern returns the matched chi route pattern, or "unmatched" when the
+// request was not routed through chi. Metrics use it as a label, so it must
+// never carry the raw path.
+func RoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
+// respondWithInternalError logs err and replies with a 500, hiding the
+// underlying error text unless running in development
+func (h *Handler) respondWithInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	logError(r, err)
+	message := "internal server error"
+	if h.exposeErrors {
+		message = err.Error()
+	}
+	respondWithError(w, http.StatusInternalServerError, message)
+}
+
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	// A map of strings always marshals
+	response, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
+
+func respondWithJSON(w http.ResponseWriter, r *http.Request, code int, payload interface{}) {
+	// Marshal before committing the status so a failure can still become a 500
+	response, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("failed to marshal response", slog.Any("error", err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"failed to encode response"}`))
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	if code == http.StatusOK && checkNotModified(w, r, response) {
+		return
+	}
 	w.WriteHeader(code)
 	w.Write(response)
 }
@@ -0,0 +1,455 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"health_app/api/model"
+	"health_app/api/store"
+)
+
+// serve runs one request against handle with a handler over memStore
+func serve(memStore *store.MemoryStore, handle func(*Handler, http.ResponseWriter, *http.Request), req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handle(NewHandler(memStore), rec, req)
+	return rec
+}
+
+// decodeError returns the message of a {"error": ...} response body
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	return body["error"]
+}
+
+func TestGetDateQueryParam(t *testing.T) {
+	today := time.Now().UTC().Format(dateLayout)
+	future := time.Now().UTC().AddDate(0, 0, 3).Format(dateLayout)
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{name: "defaults to today", query: "", want: today},
+		{name: "past date", query: "date=2024-03-05", want: "2024-03-05"},
+		{name: "malformed", query: "date=03/05/2024", wantErr: true},
+		{name: "injection", query: "date=2024-03-05'%20OR%201=1", wantErr: true},
+		{name: "future", query: "date=" + future, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			got, err := getDateQueryParam(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEndDateQueryParam(t *testing.T) {
+	today := time.Now().UTC().Format(dateLayout)
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{name: "defaults to today", query: "", want: today},
+		{name: "ignores date", query: "date=2024-03-05", want: today},
+		{name: "past date", query: "end_date=2024-03-05", want: "2024-03-05"},
+		{name: "malformed", query: "end_date=2024-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			got, err := getEndDateQueryParam(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDateRangeQueryParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{name: "both", query: "start_date=2024-03-01&end_date=2024-03-05", wantStart: "2024-03-01", wantEnd: "2024-03-05"},
+		{name: "start omitted", query: "end_date=2024-03-05", wantStart: "", wantEnd: "2024-03-05"},
+		{name: "reversed", query: "start_date=2024-03-06&end_date=2024-03-05", wantErr: true},
+		{name: "bad start", query: "start_date=yesterday&end_date=2024-03-05", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			start, end, err := getDateRangeQueryParams(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("got %q..%q, want %q..%q", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestHandleGetSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		storeErr   error
+		wantStatus int
+		wantSteps  int
+	}{
+		{name: "seeded date", query: "date=2024-03-05", wantStatus: http.StatusOK, wantSteps: 8421},
+		{name: "unseeded date", query: "date=2024-03-04", wantStatus: http.StatusOK, wantSteps: 0},
+		{name: "bad date", query: "date=tomorrow", wantStatus: http.StatusBadRequest},
+		{name: "store error", query: "date=2024-03-05", storeErr: errors.New("influx down"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			memStore.Summaries["2024-03-05"] = &model.Summary{Steps: 8421, DietaryCalories: 2100}
+			memStore.Err = tt.storeErr
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/summary?"+tt.query, nil)
+			rec := serve(memStore, (*Handler).HandleGetSummary, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if message := decodeError(t, rec); message == "" || strings.Contains(message, "influx down") {
+					t.Errorf("error message %q should be set and hide store details", message)
+				}
+				return
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := body["steps"]; got != float64(tt.wantSteps) {
+				t.Errorf("steps = %v, want %d", got, tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestHandleGetMeasurements(t *testing.T) {
+	tests := []struct {
+		name       string
+		seeded     []string
+		storeErr   error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "lists measurements", seeded: []string{"heart_rate", "step_count"}, wantStatus: http.StatusOK, wantBody: `["heart_rate","step_count"]`},
+		{name: "none yet", wantStatus: http.StatusOK, wantBody: `[]`},
+		{name: "store error", storeErr: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantBody: `{"error":"internal server error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			memStore.Measurements = tt.seeded
+			memStore.Err = tt.storeErr
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/measurements", nil)
+			rec := serve(memStore, (*Handler).HandleGetMeasurements, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleHealthz(t *testing.T) {
+	tests := []struct {
+		name       string
+		storeErr   error
+		wantStatus int
+	}{
+		{name: "reachable", wantStatus: http.StatusOK},
+		{name: "unreachable", storeErr: errors.New("connection refused"), wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			memStore.Err = tt.storeErr
+
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			rec := serve(memStore, (*Handler).HandleHealthz, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleGetVitalsHR(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		storeErr   error
+		wantStatus int
+	}{
+		{name: "defaults", query: "", wantStatus: http.StatusOK},
+		{name: "bucket", query: "date=2024-03-05&bucket=30m", wantStatus: http.StatusOK},
+		{name: "bucket too small", query: "bucket=30s", wantStatus: http.StatusBadRequest},
+		{name: "bucket unparseable", query: "bucket=often", wantStatus: http.StatusBadRequest},
+		{name: "bad date", query: "date=2024-02-30", wantStatus: http.StatusBadRequest},
+		{name: "store error", query: "date=2024-03-05", storeErr: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			memStore.HR = []model.HRBucket{{Time: "08:00", Value: 62}}
+			memStore.Err = tt.storeErr
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/vitals/hr?"+tt.query, nil)
+			rec := serve(memStore, (*Handler).HandleGetVitalsHR, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got []model.HRBucket
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Value != 62 {
+				t.Errorf("got %+v, want the seeded bucket", got)
+			}
+		})
+	}
+}
+
+func TestHandleIngestValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantInvalid []model.MetricError
+	}{
+		{
+			name:        "empty fields",
+			body:        `{"metrics":[{"measurement":"heart_rate","fields":{}},{"measurement":"step_count","fields":{"value":10}}]}`,
+			wantInvalid: []model.MetricError{{Index: 0, Reason: "at least one field is required"}},
+		},
+		{
+			name:        "missing fields",
+			body:        `{"metrics":[{"measurement":"heart_rate"}]}`,
+			wantInvalid: []model.MetricError{{Index: 0, Reason: "at least one field is required"}},
+		},
+		{
+			name:        "empty measurement",
+			body:        `{"metrics":[{"measurement":"step_count","fields":{"value":10}},{"measurement":"","fields":{"value":62}}]}`,
+			wantInvalid: []model.MetricError{{Index: 1, Reason: "measurement is required"}},
+		},
+		{
+			name:        "blank measurement",
+			body:        `{"metrics":[{"measurement":"  ","fields":{"value":62}}]}`,
+			wantInvalid: []model.MetricError{{Index: 0, Reason: "measurement is required"}},
+		},
+		{
+			name: "malformed JSON",
+			body: `{"metrics":[`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejected requests never reach the store
+			h := NewHandler(nil)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			h.HandleIngest(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			if tt.wantInvalid == nil {
+				return
+			}
+			var body model.IngestValidationError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(body.Metrics, tt.wantInvalid) {
+				t.Errorf("invalid metrics = %+v, want %+v", body.Metrics, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestHandleIngestBodyLimit(t *testing.T) {
+	t.Setenv("INGEST_MAX_BODY_BYTES", "256")
+	// An empty measurement fails validation, so bodies under the limit stop at 400
+	// before reaching the store
+	metric := `{"measurement":"","fields":{"value":62},"timestamp":"2024-03-05T08:00:00Z"}`
+	tests := []struct {
+		name       string
+		metrics    int
+		wantStatus int
+		wantError  string
+	}{
+		{name: "under the limit", metrics: 1, wantStatus: http.StatusBadRequest},
+		{name: "over the limit", metrics: 10, wantStatus: http.StatusRequestEntityTooLarge, wantError: "request body exceeds 256 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"metrics":[` + strings.Repeat(metric+",", tt.metrics-1) + metric + `]}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			NewHandler(nil).HandleIngest(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantError == "" {
+				return
+			}
+			if got := decodeError(t, rec); got != tt.wantError {
+				t.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHandleIngestNDJSONLimits(t *testing.T) {
+	valid := `{"measurement":"heart_rate","fields":{"value":62},"timestamp":"2024-03-05T08:00:00Z"}` + "\n"
+	invalid := `{"measurement":"","fields":{"value":62},"timestamp":"2024-03-05T08:00:00Z"}` + "\n"
+	tests := []struct {
+		name        string
+		maxBytes    string
+		body        string
+		wantErrors  []int // Rejections carried by each progress line
+		wantSkipped int
+		wantError   string
+	}{
+		{
+			name:       "body over the stream cap",
+			maxBytes:   "256",
+			body:       strings.Repeat(valid, 10),
+			wantErrors: []int{0},
+			wantError:  "request body exceeds 256 bytes",
+		},
+		{
+			name:        "rejections are sent in chunks",
+			body:        strings.Repeat(invalid, 2*maxProgressErrors+50),
+			wantErrors:  []int{maxProgressErrors, maxProgressErrors, 50},
+			wantSkipped: 2*maxProgressErrors + 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INGEST_MAX_STREAM_BYTES", tt.maxBytes)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			memStore := store.NewMemoryStore()
+			rec := serve(memStore, (*Handler).HandleIngest, req)
+
+			var lines []model.IngestProgress
+			decoder := json.NewDecoder(rec.Body)
+			for decoder.More() {
+				var progress model.IngestProgress
+				if err := decoder.Decode(&progress); err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, progress)
+			}
+			var gotErrors []int
+			for _, progress := range lines {
+				gotErrors = append(gotErrors, len(progress.Errors))
+			}
+			if !slices.Equal(gotErrors, tt.wantErrors) {
+				t.Fatalf("errors per line = %v, want %v", gotErrors, tt.wantErrors)
+			}
+			last := lines[len(lines)-1]
+			if !last.Done || last.Error != tt.wantError || last.Skipped != tt.wantSkipped {
+				t.Errorf("last line = %+v, want done with error %q and %d skipped", last, tt.wantError, tt.wantSkipped)
+			}
+			if len(memStore.Metrics) != 0 {
+				t.Errorf("stored %d metrics, want none", len(memStore.Metrics))
+			}
+		})
+	}
+}
+
+func TestLoadMaxIngestBytes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{value: "", want: defaultMaxIngestBytes},
+		{value: "1024", want: 1024},
+		{value: "0", want: defaultMaxIngestBytes},
+		{value: "-5", want: defaultMaxIngestBytes},
+		{value: "5MB", want: defaultMaxIngestBytes},
+	}
+	for _, tt := range tests {
+		t.Setenv("INGEST_MAX_BODY_BYTES", tt.value)
+		if got := loadMaxIngestBytes(); got != tt.want {
+			t.Errorf("loadMaxIngestBytes() with %q = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateMetricFieldTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		fieldType model.FieldType
+		wantOK    bool
+	}{
+		{name: "integer", value: 8421.0, fieldType: model.FieldTypeInteger, wantOK: true},
+		{name: "float", value: 72.5, fieldType: model.FieldTypeFloat, wantOK: true},
+		{name: "whole float", value: 72.0, fieldType: model.FieldTypeFloat, wantOK: true},
+		{name: "fractional integer", value: 72.5, fieldType: model.FieldTypeInteger},
+		{name: "integer beyond float precision", value: float64(1<<53 + 2), fieldType: model.FieldTypeInteger},
+		{name: "string typed integer", value: "8421", fieldType: model.FieldTypeInteger},
+		{name: "unknown type", value: 1.0, fieldType: "uint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := validateMetric(model.Metric{
+				Measurement: "step_count",
+				Fields:      map[string]interface{}{"value": tt.value},
+				FieldTypes:  map[string]model.FieldType{"value": tt.fieldType},
+			})
+			if (reason == "") != tt.wantOK {
+				t.Errorf("reason = %q, want ok %v", reason, tt.wantOK)
+			}
+		})
+	}
+}
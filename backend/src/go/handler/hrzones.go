@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"health_app/api/model"
+)
+
+// loadHRZones reads the max heart rate from HR_MAX and the zone lower bounds,
+// in percent of max HR, from HR_ZONES ("50,60,70,80,90"). Zones are left
+// disabled until a max heart rate is set here or per request.
+func loadHRZones() model.HRZones {
+	zones := model.HRZones{Bounds: model.DefaultHRZoneBounds}
+
+	if value := os.Getenv("HR_MAX"); value != "" {
+		maxHR, err := parseMaxHR(value)
+		if err != nil {
+			slog.Warn("invalid environment variable, zones disabled",
+				slog.String("name", "HR_MAX"), slog.String("value", value), slog.Any("error", err))
+		} else {
+			zones.MaxHR = maxHR
+		}
+	}
+
+	if value := os.Getenv("HR_ZONES"); value != "" {
+		bounds, err := parseHRZoneBounds(value)
+		if err != nil {
+			slog.Warn("invalid environment variable",
+				slog.String("name", "HR_ZONES"), slog.String("value", value),
+				slog.Any("using", zones.Bounds), slog.Any("error", err))
+		} else {
+			zones.Bounds = bounds
+		}
+	}
+	return zones
+}
+
+// parseHRZoneBounds parses five ascending percentages
+func parseHRZoneBounds(value string) ([5]float64, error) {
+	var bounds [5]float64
+	parts := strings.Split(value, ",")
+	if len(parts) != len(bounds) {
+		return bounds, fmt.Errorf("expected %d comma-separated percentages", len(bounds))
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(n) || n <= 0 || n > 100 {
+			return bounds, fmt.Errorf("%q is not a percentage between 0 and 100", part)
+		}
+		if i > 0 && n <= bounds[i-1] {
+			return bounds, fmt.Errorf("bounds must be ascending")
+		}
+		bounds[i] = n
+	}
+	return bounds, nil
+}
+
+// parseMaxHR parses a max heart rate in bpm
+func parseMaxHR(value string) (float64, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 100 || n > 250 {
+		return 0, fmt.Errorf("must be a heart rate between 100 and 250 bpm")
+	}
+	return n, nil
+}
+
+// getHRZonesQueryParam returns the configured zones with the max heart rate
+// overridden by the optional max_hr param
+func (h *Handler) getHRZonesQueryParam(r *http.Request) (model.HRZones, error) {
+	zones := h.hrZones
+	value := r.URL.Query().Get("max_hr")
+	if value == "" {
+		return zones, nil
+	}
+	maxHR, err := parseMaxHR(value)
+	if err != nil {
+		return zones, fmt.Errorf("invalid max_hr %q: %v", value, err)
+	}
+	zones.MaxHR = maxHR
+	return zones, nil
+}
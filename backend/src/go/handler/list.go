@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"health_app/api/model"
+)
+
+// wantsEnvelope reports whether list rows should be wrapped in a
+// model.ListResponse. Bare arrays stay the default so existing clients keep
+// working; new ones opt in with envelope=true. CSV exports are never wrapped.
+func wantsEnvelope(r *http.Request) bool {
+	return r.URL.Query().Get("envelope") == "true" && !wantsCSV(r)
+}
+
+// respondWithList writes rows in a model.ListResponse with meta's Count set,
+// or as the bare list when the client didn't ask for the envelope. An unpaged
+// list's Total is its Count.
+func respondWithList[T any](w http.ResponseWriter, r *http.Request, code int, rows []T, meta model.ListMeta) {
+	if !wantsEnvelope(r) {
+		respondWithData(w, r, code, rows)
+		return
+	}
+	if rows == nil {
+		rows = []T{}
+	}
+	meta.Count = len(rows)
+	if meta.Total == 0 {
+		meta.Total = meta.Count
+	}
+	respondWithJSON(w, r, code, model.ListResponse[T]{Data: rows, Meta: meta})
+}
+
+// sleepListKind picks the sleep list whose default window matches interval
+func sleepListKind(interval model.Interval) model.ListKind {
+	switch interval {
+	case model.IntervalWeek:
+		return model.ListSleepWeekly
+	case model.IntervalMonth:
+		return model.ListSleepMonthly
+	default:
+		return model.ListSleep
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"health_app/api/model"
+	"health_app/api/store"
+)
+
+func TestListEnvelope(t *testing.T) {
+	reading := []model.BloodPressure{{Time: "Mar 05", Systolic: 118, Diastolic: 76, Category: "Normal"}}
+	workouts := []model.Workout{
+		{ID: "a", Time: "Mar 04", Name: "Run", Duration: 30, Calories: 300, Type: "cardio", AvgHr: 150},
+		{ID: "b", Time: "Mar 05", Name: "Walk", Duration: 20, Calories: 100, Type: "cardio", AvgHr: 100},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		handle     func(*Handler, http.ResponseWriter, *http.Request)
+		seeded     []model.BloodPressure
+		storeErr   error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "bare array by default",
+			path:       "/api/v1/vitals/bp?end_date=2024-03-05",
+			handle:     (*Handler).HandleGetVitalsBP,
+			seeded:     reading,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"time":"Mar 05","systolic":118,"diastolic":76,"category":"Normal"}]`,
+		},
+		{
+			name:       "enveloped on opt in",
+			path:       "/api/v1/vitals/bp?start_date=2024-03-01&end_date=2024-03-05&envelope=true",
+			handle:     (*Handler).HandleGetVitalsBP,
+			seeded:     reading,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[{"time":"Mar 05","systolic":118,"diastolic":76,"category":"Normal"}],"meta":{"start":"2024-03-01","stop":"2024-03-05","count":1,"total":1,"offset":0}}`,
+		},
+		{
+			name:       "empty envelope is an empty array",
+			path:       "/api/v1/vitals/bp?start_date=2024-03-01&end_date=2024-03-05&envelope=true",
+			handle:     (*Handler).HandleGetVitalsBP,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[],"meta":{"start":"2024-03-01","stop":"2024-03-05","count":0,"total":0,"offset":0}}`,
+		},
+		{
+			name:       "CSV is never wrapped",
+			path:       "/api/v1/vitals/bp?end_date=2024-03-05&envelope=true",
+			accept:     "text/csv",
+			handle:     (*Handler).HandleGetVitalsBP,
+			seeded:     reading,
+			wantStatus: http.StatusOK,
+			wantBody:   "time,systolic,diastolic,category\nMar 05,118,76,Normal\n",
+		},
+		{
+			name:       "unpaged workouts are a bare array",
+			path:       "/api/v1/workouts?date=2024-03-05",
+			handle:     (*Handler).HandleGetWorkouts,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"id":"a","time":"Mar 04","name":"Run","duration":30,"calories":300,"type":"cardio","avgHr":150},{"id":"b","time":"Mar 05","name":"Walk","duration":20,"calories":100,"type":"cardio","avgHr":100}]`,
+		},
+		{
+			name:       "paged workouts keep the page shape",
+			path:       "/api/v1/workouts?date=2024-03-05&limit=1&offset=1",
+			handle:     (*Handler).HandleGetWorkouts,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"workouts":[{"id":"b","time":"Mar 05","name":"Walk","duration":20,"calories":100,"type":"cardio","avgHr":100}],"total":2,"offset":1}`,
+		},
+		{
+			name:       "paged workouts enveloped on opt in",
+			path:       "/api/v1/workouts?start_date=2024-03-01&date=2024-03-05&limit=1&envelope=true",
+			handle:     (*Handler).HandleGetWorkouts,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[{"id":"a","time":"Mar 04","name":"Run","duration":30,"calories":300,"type":"cardio","avgHr":150}],"meta":{"start":"2024-03-01","stop":"2024-03-05","count":1,"total":2,"offset":0}}`,
+		},
+		{
+			name:       "bad range",
+			path:       "/api/v1/vitals/bp?start_date=2024-03-06&end_date=2024-03-05&envelope=true",
+			handle:     (*Handler).HandleGetVitalsBP,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown standard",
+			path:       "/api/v1/vitals/bp?end_date=2024-03-05&standard=who",
+			handle:     (*Handler).HandleGetVitalsBP,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "store error",
+			path:       "/api/v1/vitals/bp?end_date=2024-03-05&envelope=true",
+			handle:     (*Handler).HandleGetVitalsBP,
+			storeErr:   errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal server error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			memStore.BloodPressure = tt.seeded
+			memStore.Workouts = workouts
+			memStore.Err = tt.storeErr
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := serve(memStore, tt.handle, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Body.String(); tt.wantBody != "" && got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
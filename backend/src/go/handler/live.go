@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"health_app/api/model"
+)
+
+// defaultLiveHRInterval is how often the live heart rate stream polls the store
+const defaultLiveHRInterval = 5 * time.Second
+
+// loadLiveHRInterval reads HR_LIVE_INTERVAL, e.g. "10s", of at least a second
+func loadLiveHRInterval() time.Duration {
+	value := os.Getenv("HR_LIVE_INTERVAL")
+	if value == "" {
+		return defaultLiveHRInterval
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "HR_LIVE_INTERVAL"), slog.String("value", value), slog.Duration("using", defaultLiveHRInterval))
+		return defaultLiveHRInterval
+	}
+	return d
+}
+
+// StopStreams ends every open event stream so graceful shutdown doesn't wait
+// on clients that never disconnect
+func (h *Handler) StopStreams() {
+	h.stopStreams.Do(func() { close(h.streamsDone) })
+}
+
+// HandleGetVitalsHRLive streams the newest heart rate reading as server-sent
+// events, polling every HR_LIVE_INTERVAL. Each new reading is sent once as an
+// "hr" event; ticks without one send a comment to keep proxies from timing the
+// connection out. The stream ends when the client disconnects.
+func (h *Handler) HandleGetVitalsHRLive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(h.liveHRInterval)
+	defer ticker.Stop()
+	lastSent := ""
+	for {
+		latest, err := h.store.GetLatestHR(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, model.ErrNotFound):
+			fmt.Fprint(w, ": no readings\n\n")
+		case err != nil:
+			logError(r, err)
+			fmt.Fprint(w, "event: error\ndata: {\"error\":\"failed to read heart rate\"}\n\n")
+		case latest.Time == lastSent:
+			fmt.Fprint(w, ": no new reading\n\n")
+		default:
+			data, _ := json.Marshal(latest)
+			fmt.Fprintf(w, "event: hr\ndata: %s\n\n", data)
+			lastSent = latest.Time
+		}
+		// A failed flush means the client has gone
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.streamsDone:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"health_app/api/model"
+)
+
+// maxNDJSONLineBytes caps a single streamed metric
+const maxNDJSONLineBytes = 1 << 20
+
+// maxProgressErrors is how many rejections a progress line carries at most; a
+// body full of bad lines sends a line each time this many pile up
+const maxProgressErrors = 100
+
+func isNDJSONContentType(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-ndjson"
+}
+
+// handleIngestNDJSON ingests a body of one Metric per line, writing every
+// ingestBatchSize metrics so the batch is never held in memory whole. Earlier
+// batches are already written by the time a later line fails, so bad lines are
+// skipped and reported rather than rejecting the request, and progress is
+// streamed back as one IngestProgress line per batch. The body is capped at
+// maxStreamBytes. With dry_run=true each batch is validated and encoded but not
+// written.
+func (h *Handler) handleIngestNDJSON(w http.ResponseWriter, r *http.Request) {
+	// There's no request envelope, so the precision comes from the query string
+	precision, err := validatePrecision(model.Precision(r.URL.Query().Get("precision")))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	userID := model.UserIDFromContext(r.Context())
+	dryRun := isDryRun(r)
+	ingest := h.store.Ingest
+	status := http.StatusAccepted
+	if dryRun {
+		ingest = h.store.ValidateIngest
+		status = http.StatusOK
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxStreamBytes)
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(status)
+
+	progress := model.IngestProgress{DryRun: dryRun}
+	report := func() {
+		encoder.Encode(progress)
+		rc.Flush()
+		progress.Errors = nil
+	}
+	batch := make([]model.Metric, 0, h.ingestBatchSize)
+	writeBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tagUserID(batch, userID)
+		result, err := ingest(r.Context(), batch, precision)
+		if err != nil {
+			return err
+		}
+		progress.Written += result.Written
+		progress.Skipped += result.Skipped
+		progress.Errors = append(progress.Errors, result.Errors...)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxNDJSONLineBytes)
+	for scanner.Scan() {
+		if scanner.Err() != nil {
+			// A read error (e.g. hitting the body cap) cut this line short
+			break
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		progress.Lines++
+
+		var metric model.Metric
+		reason := ""
+		if err := json.Unmarshal(line, &metric); err != nil {
+			reason = err.Error()
+		} else if invalid := validateMetrics([]model.Metric{metric}, userID); len(invalid) > 0 {
+			reason = invalid[0].Reason
+		} else if len(h.valueRanges) > 0 {
+			reason = h.checkValueRange(metric)
+		}
+		if reason != "" {
+			progress.Skipped++
+			progress.Errors = append(progress.Errors, fmt.Sprintf("line %d: %s", progress.Lines, reason))
+			if len(progress.Errors) >= maxProgressErrors {
+				report()
+			}
+			continue
+		}
+
+		batch = append(batch, metric)
+		if len(batch) < h.ingestBatchSize {
+			continue
+		}
+		if err := writeBatch(); err != nil {
+			h.endIngestStream(r, encoder, progress, err)
+			return
+		}
+		report()
+	}
+	if err := scanner.Err(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, bufio.ErrTooLong):
+			progress.Error = fmt.Sprintf("line %d exceeds %d bytes", progress.Lines+1, maxNDJSONLineBytes)
+		case errors.As(err, &maxBytesErr):
+			progress.Error = fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit)
+		default:
+			h.endIngestStream(r, encoder, progress, err)
+			return
+		}
+		progress.Done = true
+		encoder.Encode(progress)
+		return
+	}
+
+	if err := writeBatch(); err != nil {
+		h.endIngestStream(r, encoder, progress, err)
+		return
+	}
+	progress.Done = true
+	encoder.Encode(progress)
+}
+
+// endIngestStream reports an error that stopped a streamed ingest. The status
+// line has already been sent, so the error goes in the final progress line.
+func (h *Handler) endIngestStream(r *http.Request, encoder *json.Encoder, progress model.IngestProgress, err error) {
+	logError(r, err)
+	progress.Done = true
+	progress.Error = "internal server error"
+	if h.exposeErrors {
+		progress.Error = err.Error()
+	}
+	encoder.Encode(progress)
+}
@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"health_app/api/model"
+)
+
+// apiParam describes a query or path parameter in the OpenAPI spec
+type apiParam struct {
+	name        string
+	in          string
+	description string
+	schema      map[string]any
+}
+
+func queryParam(name, description string, schema map[string]any) apiParam {
+	return apiParam{name: name, in: "query", description: description, schema: schema}
+}
+
+var (
+	stringSchema  = map[string]any{"type": "string"}
+	dateSchema    = map[string]any{"type": "string", "format": "date"}
+	integerSchema = map[string]any{"type": "integer"}
+	numberSchema  = map[string]any{"type": "number"}
+	booleanSchema = map[string]any{"type": "boolean"}
+
+	dateParam      = queryParam("date", "Day to query (YYYY-MM-DD); defaults to today", dateSchema)
+	endDateParam   = queryParam("end_date", "Last day of the range (YYYY-MM-DD); defaults to today", dateSchema)
+	startDateParam = queryParam("start_date", "First day of the range (YYYY-MM-DD); defaults to the endpoint's window", dateSchema)
+	sourceParam    = queryParam("source", "Device whose data is used; defaults to "+defaultSource, stringSchema)
+	unitsParam     = queryParam("units", "Output units", map[string]any{"type": "string", "enum": []string{"metric", "imperial"}})
+	rangeParams    = []apiParam{startDateParam, endDateParam}
+	fieldsParam    = queryParam("fields", "Comma-separated fields to return as a map of field to series, e.g. min,max for heart rate", stringSchema)
+	envelopeParam  = queryParam("envelope", "Set to true to wrap the rows in a data/meta envelope", booleanSchema)
+
+	// tzParam is accepted by every GET route
+	tzParam = queryParam("tz", "Timestamp rendering: local (server APP_TIMEZONE labels, the default), utc (ISO 8601 UTC timestamps) or an IANA zone name", stringSchema)
+)
+
+// apiRoute describes one /api/v1 route. response is a zero value of the
+// success body; nil means the route returns no body. mediaType overrides
+// application/json for streamed responses, with response describing each event.
+type apiRoute struct {
+	method    string
+	path      string
+	summary   string
+	params    []apiParam
+	request   any
+	status    int
+	response  any
+	mediaType string
+}
+
+// apiRoutes must be kept in step with the routes registered in main.go
+var apiRoutes = []apiRoute{
+	{method: "post", path: "/ingest", summary: "Write a batch of metrics; send application/x-ndjson with one Metric per line to stream large batches", params: []apiParam{
+		queryParam("precision", "Timestamp precision for NDJSON bodies; JSON bodies set the precision field", map[string]any{"type": "string", "enum": []string{"s", "ms", "us", "ns"}}),
+		queryParam("dry_run", "Validate and encode the batch without writing it; responds 200 with the would-be result", map[string]any{"type": "boolean"}),
+	}, request: model.IngestRequest{}, status: http.StatusAccepted, response: model.IngestResult{}},
+	{method: "patch", path: "/metrics", summary: "Overwrite fields of the one point with the given measurement, tags and timestamp", request: model.Metric{}, response: model.PatchResult{}},
+	{method: "post", path: "/admin/recompute", summary: "Rebuild a day's daily_totals from the raw step, energy and distance readings; requires API_TOKENS", params: []apiParam{dateParam}, status: http.StatusNoContent},
+	{method: "get", path: "/summary", summary: "Daily activity and energy totals", params: []apiParam{dateParam, sourceParam}, response: model.Summary{}},
+	{method: "get", path: "/dashboard", summary: "Every dashboard section for a day", params: []apiParam{dateParam, sourceParam}, response: model.Dashboard{}},
+	{method: "get", path: "/sources", summary: "Sources that have reported daily totals", response: []string{}},
+	{method: "get", path: "/measurements", summary: "Measurements present in the database", response: []string{}},
+	{method: "get", path: "/calendar/{measurement}", summary: "Local days (YYYY-MM-DD) with at least one point; defaults to the month of end_date", params: append([]apiParam{
+		{name: "measurement", in: "path", description: "Measurement name", schema: stringSchema},
+	}, rangeParams...), response: []string{}},
+	{method: "get", path: "/status/last-sync", summary: "Newest point overall and per measurement", response: model.SyncStatus{}},
+	{method: "get", path: "/vitals/hr/live", summary: "Server-sent \"hr\" events carrying each new heart rate reading", response: model.HRBucket{}, mediaType: "text/event-stream"},
+	{method: "get", path: "/vitals/hr", summary: "Heart rate for a day, bucketed unless raw", params: []apiParam{
+		dateParam,
+		queryParam("raw", "Return every reading instead of buckets", booleanSchema),
+		queryParam("bucket", "Bucket width as a Go duration of at least 1m, e.g. 10m (the default)", stringSchema),
+		queryParam("max_points", "Cap on returned points; buckets are widened to stay under it, and raw readings are bucketed when there are more", integerSchema),
+		queryParam("fields", "Comma-separated avg, min and max; returns a map of field to raw series instead of buckets", stringSchema),
+	}, response: []model.HRBucket{}},
+	{method: "get", path: "/vitals/hr/daily", summary: "Daily heart rate min/max/avg", params: rangeParams, response: []model.HRDailyStat{}},
+	{method: "get", path: "/vitals/bp", summary: "Blood pressure readings", params: append([]apiParam{
+		queryParam("standard", "Guideline used for categories", map[string]any{"type": "string", "enum": []string{"acc_aha", "esc", "jnc7"}}),
+		envelopeParam,
+	}, rangeParams...), response: []model.BloodPressure{}},
+	{method: "get", path: "/vitals/glucose", summary: "Blood glucose readings; aggregate=daily returns []GlucoseDaily instead", params: append([]apiParam{
+		queryParam("aggregate", "raw readings or one min/max/avg row per day", map[string]any{"type": "string", "enum": []string{"raw", "daily"}}),
+		envelopeParam,
+	}, rangeParams...), response: []model.Glucose{}},
+	{method: "get", path: "/vitals/glucose/stats", summary: "Glucose average, variability, GMI and time in range", params: append([]apiParam{
+		queryParam("low", "Bottom of the target range in mg/dL", numberSchema),
+		queryParam("high", "Top of the target range in mg/dL", numberSchema),
+	}, rangeParams...), response: model.GlucoseStats{}},
+	{method: "get", path: "/vitals/spo2", summary: "Blood oxygen saturation", params: rangeParams, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/hrv", summary: "Daily average heart rate variability", params: rangeParams, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/respiratory", summary: "Respiratory rate", params: rangeParams, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/vo2max", summary: "VO2 max readings", params: rangeParams, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/{metric}", summary: "Raw readings of any registered vital (hr, resting-hr, hrv, spo2, respiratory, vo2max, glucose, systolic, diastolic, temperature)", params: append([]apiParam{
+		{name: "metric", in: "path", description: "Vital name", schema: stringSchema},
+		fieldsParam,
+	}, rangeParams...), response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/temperature", summary: "Body temperature in °C, or °F with units=imperial", params: append([]apiParam{unitsParam}, rangeParams...), response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/vitals/resting-hr", summary: "Daily resting heart rate", params: rangeParams, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/sleep", summary: "Sleep per night, or weekly/monthly averages", params: append([]apiParam{
+		queryParam("interval", "Grouping of nights", map[string]any{"type": "string", "enum": []string{"day", "week", "month"}}),
+		envelopeParam,
+	}, rangeParams...), response: []model.Sleep{}},
+	{method: "get", path: "/sleep/stages", summary: "Stage timeline (hypnogram) for the night ending on date", params: []apiParam{
+		queryParam("date", "Day the night ends on (YYYY-MM-DD); defaults to today", dateSchema),
+	}, response: []model.SleepStageSegment{}},
+	{method: "get", path: "/activity/steps", summary: "Hourly step counts for a day", params: []apiParam{dateParam}, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/activity/distance", summary: "Daily walking and running distance in km, or miles with units=imperial", params: []apiParam{endDateParam, unitsParam}, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/activity/active-energy", summary: "Hourly active energy for a day", params: []apiParam{dateParam, sourceParam}, response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/workouts", summary: "Workouts; paged when limit or offset is given", params: []apiParam{
+		startDateParam, dateParam, unitsParam,
+		queryParam("type", "Only workouts with this name", stringSchema),
+		queryParam("limit", "Maximum workouts to return", integerSchema),
+		queryParam("offset", "Workouts to skip", integerSchema),
+		envelopeParam,
+	}, response: model.WorkoutPage{}},
+	{method: "get", path: "/workouts/weekly", summary: "Workout duration, calories and count per ISO week", params: []apiParam{endDateParam}, response: []model.WorkoutWeek{}},
+	{method: "get", path: "/workouts/types", summary: "Distinct workout names", response: []string{}},
+	{method: "get", path: "/workouts/{id}", summary: "A workout with its heart rate series", params: []apiParam{
+		{name: "id", in: "path", description: "Workout ID", schema: stringSchema},
+		unitsParam,
+		queryParam("max_hr", "Max heart rate in bpm for the zone breakdown; defaults to HR_MAX, and zones are omitted when neither is set", numberSchema),
+	}, response: model.WorkoutDetail{}},
+	{method: "get", path: "/dietary/trends", summary: "Daily nutrients with rolling averages", params: append([]apiParam{
+		queryParam("window", "Rolling average window in days (2-30)", integerSchema),
+	}, rangeParams...), response: []model.DietaryTrend{}},
+	{method: "get", path: "/dietary/totals", summary: "Nutrient totals for a day", params: []apiParam{dateParam}, response: model.DietaryTotals{}},
+	{method: "get", path: "/dietary/macros-breakdown", summary: "Grams and calorie share of protein, carbs and fat for a day", params: []apiParam{dateParam}, response: model.MacroBreakdown{}},
+	{method: "get", path: "/dietary/meals/today", summary: "Calories per meal for a day", params: []apiParam{dateParam}, response: []model.Meal{}},
+	{method: "get", path: "/body/composition", summary: "Weight and body fat pairs with weight trend", params: append([]apiParam{unitsParam}, rangeParams...), response: []model.BodyComposition{}},
+	{method: "get", path: "/body/weight", summary: "Weight readings", params: append([]apiParam{unitsParam}, rangeParams...), response: []model.TimeSeriesValue{}},
+	{method: "get", path: "/body/fat", summary: "Body fat percentage readings", params: rangeParams, response: []model.TimeSeriesValue{}},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+// HandleOpenAPI serves an OpenAPI 3 description of the /api/v1 routes
+func (h *Handler) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() { openAPIDoc = buildOpenAPISpec() })
+	respondWithJSON(w, r, http.StatusOK, openAPIDoc)
+}
+
+// HandleDocs serves Swagger UI pointed at /openapi.json
+func (h *Handler) HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Health App API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });</script>
+</body>
+</html>
+`
+
+func buildOpenAPISpec() map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]any)
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"error": stringSchema},
+		}}},
+	}
+
+	for _, route := range apiRoutes {
+		routeParams := route.params
+		if route.method == "get" {
+			routeParams = append(append([]apiParam(nil), route.params...), tzParam)
+		}
+		var params []any
+		for _, p := range routeParams {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"required":    p.in == "path",
+				"description": p.description,
+				"schema":      p.schema,
+			})
+		}
+
+		status := route.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		mediaType := route.mediaType
+		if mediaType == "" {
+			mediaType = "application/json"
+		}
+		if route.response != nil {
+			success["content"] = map[string]any{mediaType: map[string]any{
+				"schema": schemaFor(reflect.TypeOf(route.response), schemas),
+			}}
+		}
+
+		op := map[string]any{
+			"summary": route.summary,
+			"responses": map[string]any{
+				strconv.Itoa(status): success,
+				"default":            errorResponse,
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"application/json": map[string]any{
+					"schema": schemaFor(reflect.TypeOf(route.request), schemas),
+				}},
+			}
+		}
+
+		path := "/api/v1" + route.path
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[path] = item
+		}
+		item[route.method] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Health App API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+// schemaFor maps a Go type to a JSON schema, registering named structs under
+// components/schemas and returning a $ref to them
+func schemaFor(t reflect.Type, schemas map[string]any) map[string]any {
+	if t.Kind() == reflect.Ptr {
+		schema := schemaFor(t.Elem(), schemas)
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+		if _, done := schemas[name]; done {
+			return ref
+		}
+		// Register before recursing so self-referencing types terminate
+		schemas[name] = map[string]any{}
+		properties := make(map[string]any)
+		addStructProperties(t, properties, schemas)
+		schemas[name] = map[string]any{"type": "object", "properties": properties}
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+// schemaName names a struct's component schema. Instantiated generics such as
+// ListResponse[health_app/api/model.Sleep] become ListResponseSleep, as
+// component names can't contain brackets or slashes.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	open := strings.Index(name, "[")
+	if open < 0 {
+		return name
+	}
+	arg := strings.TrimSuffix(name[open+1:], "]")
+	if dot := strings.LastIndex(arg, "."); dot >= 0 {
+		arg = arg[dot+1:]
+	}
+	return name[:open] + arg
+}
+
+// addStructProperties adds t's JSON-visible fields to properties, flattening
+// embedded structs the way encoding/json does
+func addStructProperties(t reflect.Type, properties map[string]any, schemas map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, hasTag := field.Tag.Lookup("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && !hasTag && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, properties, schemas)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, schemas)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"health_app/api/model"
+)
+
+// valueRange is an inclusive range of plausible values for a field
+type valueRange struct {
+	min, max float64
+}
+
+// defaultValueRanges are the plausible ranges checked on ingest, keyed by
+// measurement (applying to every numeric field) or measurement.field. Values
+// are in the units the sync client writes: kg, °C, mg/dL.
+var defaultValueRanges = map[string]valueRange{
+	"heart_rate":               {20, 250},
+	"resting_heart_rate":       {20, 200},
+	"heart_rate_variability":   {1, 300},
+	"respiratory_rate":         {4, 60},
+	"blood_oxygen":             {0.5, 100}, // Fraction or percentage
+	"blood_glucose":            {20, 600},
+	"blood_pressure.systolic":  {50, 260},
+	"blood_pressure.diastolic": {30, 160},
+	"body_fat_percentage":      {1, 75},
+	"weight_body_mass":         {20, 350},
+	"body_temperature":         {30, 45},
+	"vo2_max":                  {10, 90},
+	"step_count":               {0, 100000},
+}
+
+// loadValueRanges returns the ingest sanity ranges: the defaults overridden or
+// extended by INGEST_VALUE_RANGES ("key:min-max,..."). INGEST_VALUE_RANGES=off
+// disables the checks.
+func loadValueRanges() map[string]valueRange {
+	value := strings.TrimSpace(os.Getenv("INGEST_VALUE_RANGES"))
+	if value == "off" {
+		return nil
+	}
+
+	ranges := make(map[string]valueRange, len(defaultValueRanges))
+	for key, r := range defaultValueRanges {
+		ranges[key] = r
+	}
+	if value == "" {
+		return ranges
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		key, bounds, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		low, high, okBounds := strings.Cut(bounds, "-")
+		lo, errLo := strconv.ParseFloat(low, 64)
+		hi, errHi := strconv.ParseFloat(high, 64)
+		if !ok || key == "" || !okBounds || errLo != nil || errHi != nil || lo > hi {
+			slog.Warn("invalid environment variable entry, expected key:min-max",
+				slog.String("name", "INGEST_VALUE_RANGES"), slog.String("entry", entry))
+			continue
+		}
+		ranges[key] = valueRange{lo, hi}
+	}
+	return ranges
+}
+
+// checkValueRange returns why m has an implausible value, or "" if every
+// numeric field is within its range. A measurement.field range takes
+// precedence over the measurement's.
+func (h *Handler) checkValueRange(m model.Metric) string {
+	for field, v := range m.Fields {
+		number, ok := v.(float64)
+		if !ok {
+			continue
+		}
+		r, ok := h.valueRanges[m.Measurement+"."+field]
+		if !ok {
+			r, ok = h.valueRanges[m.Measurement]
+		}
+		if ok && (number < r.min || number > r.max) {
+			return fmt.Sprintf("field %q value %g is outside the plausible range %g–%g", field, number, r.min, r.max)
+		}
+	}
+	return ""
+}
+
+// filterValueRanges splits metrics into those with plausible values and a
+// rejection for each of the rest, indexed by position in metrics
+func (h *Handler) filterValueRanges(metrics []model.Metric) ([]model.Metric, []model.MetricError) {
+	if len(h.valueRanges) == 0 {
+		return metrics, nil
+	}
+	kept := make([]model.Metric, 0, len(metrics))
+	var rejected []model.MetricError
+	for i, m := range metrics {
+		if reason := h.checkValueRange(m); reason != "" {
+			rejected = append(rejected, model.MetricError{Index: i, Reason: reason})
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept, rejected
+}
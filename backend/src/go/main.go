@@ -2,11 +2,12 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -14,48 +15,144 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"health_app/api/handler"
 	"health_app/api/store"
 )
 
+// Every store implementation must keep satisfying the handler's Store
+// interface; MemoryStore backs handler tests without a live InfluxDB.
+var (
+	_ handler.Store = (*store.InfluxDBStore)(nil)
+	_ handler.Store = (*store.MemoryStore)(nil)
+	_ handler.Store = (*handler.CachingStore)(nil)
+)
+
+const (
+	startupConnectAttempts  = 5
+	startupConnectBaseDelay = time.Second
+)
+
+// loadLogLevel reads LOG_LEVEL (debug, info, warn or error), defaulting to
+// info. DEBUG=true is shorthand for LOG_LEVEL=debug.
+func loadLogLevel() slog.Level {
+	if debug, _ := strconv.ParseBool(os.Getenv("DEBUG")); debug {
+		return slog.LevelDebug
+	}
+	value := os.Getenv("LOG_LEVEL")
+	if value == "" {
+		return slog.LevelInfo
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "LOG_LEVEL"), slog.String("value", value), slog.String("using", "info"))
+		return slog.LevelInfo
+	}
+	return level
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+		slog.Info("no .env file found, using environment variables")
 	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: loadLogLevel()})))
 
 	influxStore, err := store.NewInfluxDBStore()
 	if err != nil {
 		log.Fatalf("Failed to create InfluxDB store: %v", err)
 	}
 
-	h := handler.NewHandler(influxStore)
+	var appStore handler.Store = influxStore
+	if enabled, _ := strconv.ParseBool(os.Getenv("QUERY_CACHE")); enabled {
+		appStore = handler.NewCachingStore(influxStore)
+		slog.Info("query cache enabled")
+	}
+	h := handler.NewHandler(appStore)
+
+	ingestLimit, ingestBurst := loadIngestRateLimit()
+	ingestLimiter := newIPRateLimiter(ingestLimit, ingestBurst)
 
 	r := chi.NewRouter()
 
 	// CORS middleware
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://*", "https://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	allowedOrigins := loadAllowedOrigins()
+	corsOptions := cors.Options{
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
-	}))
+	}
+	// cors treats an empty origin list as allow-all, so deny explicitly
+	if len(allowedOrigins) == 0 {
+		corsOptions.AllowOriginFunc = denyAllOrigins
+	}
+	r.Use(cors.Handler(corsOptions))
 
-	r.Use(middleware.Logger)
+	r.Use(middleware.RequestID)
+	r.Use(requestLogger)
+	r.Use(metricsMiddleware)
 	r.Use(middleware.Recoverer)
+	r.Use(middleware.Compress(5, "application/json"))
+	r.Use(skipSmallCompression(minCompressSize))
+	r.Use(measureBody)
+
+	// Registered before the /api/v1 subrouter so it inherits them
+	r.NotFound(h.HandleNotFound)
+	r.MethodNotAllowed(h.HandleMethodNotAllowed)
+
+	r.Get("/healthz", h.HandleHealthz)
+	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/openapi.json", h.HandleOpenAPI)
+	r.Get("/docs", h.HandleDocs)
 
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/ingest", h.HandleIngest)
+		r.Use(authenticate(loadAPITokens()))
+		r.Use(timezone)
+		// Every endpoint that writes data shares the same guard
+		r.Group(func(r chi.Router) {
+			r.Use(requireUser)
+			r.With(ingestLimiter.middleware).Post("/ingest", h.HandleIngest)
+			r.Patch("/metrics", h.HandlePatchMetric)
+			r.Post("/admin/recompute", h.HandleRecomputeDailyTotals)
+		})
 		r.Get("/summary", h.HandleGetSummary)
+		r.Get("/dashboard", h.HandleGetDashboard)
+		r.Get("/sources", h.HandleGetSources)
+		r.Get("/measurements", h.HandleGetMeasurements)
+		r.Get("/calendar/{measurement}", h.HandleGetDatesWithData)
+		r.Get("/status/last-sync", h.HandleGetLastSync)
 		r.Get("/vitals/hr", h.HandleGetVitalsHR)
+		r.Get("/vitals/hr/daily", h.HandleGetHRDailyStats)
+		r.Get("/vitals/hr/live", h.HandleGetVitalsHRLive)
 		r.Get("/vitals/bp", h.HandleGetVitalsBP)
 		r.Get("/vitals/glucose", h.HandleGetVitalsGlucose)
+		r.Get("/vitals/glucose/stats", h.HandleGetGlucoseStats)
+		r.Get("/vitals/spo2", h.HandleGetVitalsSpo2)
+		r.Get("/vitals/hrv", h.HandleGetVitalsHRV)
+		r.Get("/vitals/respiratory", h.HandleGetVitalsRespiratoryRate)
+		r.Get("/vitals/vo2max", h.HandleGetVitalsVO2Max)
+		r.Get("/vitals/temperature", h.HandleGetBodyTemperature)
+		r.Get("/vitals/{metric}", h.HandleGetVital)
+		r.Get("/vitals/resting-hr", h.HandleGetRestingHR)
 		r.Get("/sleep", h.HandleGetSleep)
+		r.Get("/sleep/stages", h.HandleGetSleepStages)
+		r.Get("/activity/steps", h.HandleGetStepsSeries)
+		r.Get("/activity/active-energy", h.HandleGetActiveEnergySeries)
+		r.Get("/activity/distance", h.HandleGetDistanceSeries)
 		r.Get("/workouts", h.HandleGetWorkouts)
+		r.Get("/workouts/types", h.HandleGetWorkoutTypes)
+		r.Get("/workouts/weekly", h.HandleGetWorkoutWeeklyVolume)
+		r.Get("/workouts/{id}", h.HandleGetWorkoutDetail)
 		r.Get("/dietary/trends", h.HandleGetDietaryTrends)
+		r.Get("/dietary/totals", h.HandleGetDietaryTotals)
+		r.Get("/dietary/macros-breakdown", h.HandleGetMacroBreakdown)
 		r.Get("/dietary/meals/today", h.HandleGetDietaryMealsToday)
 		r.Get("/body/composition", h.HandleGetBodyComposition)
+		r.Get("/body/weight", h.HandleGetWeight)
+		r.Get("/body/fat", h.HandleGetBodyFat)
 	})
 
 	port := os.Getenv("PORT")
@@ -67,6 +164,7 @@ func main() {
 		Addr:    ":" + port,
 		Handler: r,
 	}
+	server.RegisterOnShutdown(h.StopStreams)
 
 	// Channel to listen for interrupt or terminate signals
 	quit := make(chan os.Signal, 1)
@@ -74,15 +172,18 @@ func main() {
 
 	// Start server in a goroutine
 	go func() {
-		fmt.Printf("Server starting on port %s...\n", port)
+		slog.Info("server starting", slog.String("port", port))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
+	// Connect in the background so /healthz is reachable (and reports 503)
+	// while InfluxDB is still starting
+	go waitForStore(influxStore)
 
 	// Block until we receive a signal
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -90,12 +191,40 @@ func main() {
 
 	// Attempt graceful shutdown
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", slog.Any("error", err))
 	}
 
+	// Let writes still in flight finish before the client goes away
+	drained, abandoned := influxStore.Drain(ctx)
+	slog.Info("drained pending writes", slog.Int("drained", drained), slog.Int("abandoned", abandoned))
+
 	// Clean up InfluxDB connection
-	log.Println("Closing InfluxDB connection...")
+	slog.Info("closing InfluxDB connection")
 	influxStore.Close()
 
-	log.Println("Server exited")
+	slog.Info("server exited")
+}
+
+// waitForStore pings InfluxDB with exponential backoff while the server is
+// already listening, logging once it connects. If it never answers the store
+// still reconnects on use, and /healthz reports 503 until it does.
+func waitForStore(s *store.InfluxDBStore) {
+	delay := startupConnectBaseDelay
+	for attempt := 1; attempt <= startupConnectAttempts; attempt++ {
+		err := s.Ping(context.Background())
+		if err == nil {
+			slog.Info("connected to InfluxDB")
+			return
+		}
+		if attempt == startupConnectAttempts {
+			slog.Warn("InfluxDB not reachable, giving up until the next request",
+				slog.Int("attempts", attempt), slog.Any("error", err))
+			return
+		}
+		slog.Info("InfluxDB not reachable, retrying",
+			slog.Int("attempt", attempt), slog.Int("attempts", startupConnectAttempts),
+			slog.Duration("delay", delay), slog.Any("error", err))
+		time.Sleep(delay)
+		delay *= 2
+	}
 }
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+	"health_app/api/handler"
+	"health_app/api/model"
+)
+
+// minCompressSize is the smallest response body worth gzipping; below this the
+// gzip header and CPU cost outweigh the savings
+const minCompressSize = 1024
+
+// requestLogger logs one structured line per request, tagged with the ID set
+// by middleware.RequestID. bytes is what went over the wire, after any
+// compression; body_bytes is the serialized response as the handler wrote it,
+// as recorded by measureBody.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		bodyBytes := new(int)
+		r = r.WithContext(context.WithValue(r.Context(), bodyBytesKey{}, bodyBytes))
+
+		defer func() {
+			slog.InfoContext(r.Context(), "request",
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", handler.RoutePattern(r)),
+				slog.String("query", r.URL.RawQuery),
+				slog.Int("status", ww.Status()),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Int("body_bytes", *bodyBytes),
+				slog.String("content_encoding", ww.Header().Get("Content-Encoding")),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+type bodyBytesKey struct{}
+
+// measureBody records the uncompressed response size for requestLogger. It
+// must be registered after the compression middleware so it sees the body
+// before gzip does.
+func measureBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyBytes, ok := r.Context().Value(bodyBytesKey{}).(*int)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() { *bodyBytes = ww.BytesWritten() }()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// metricsMiddleware records request counts and latencies per route. Routes are
+// labelled by their chi pattern so path and query values don't explode the
+// label set.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := handler.RoutePattern(r)
+		status := strconv.Itoa(ww.Status())
+		httpRequests.WithLabelValues(r.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Defaults for the ingest rate limit, overridable via INGEST_RATE_LIMIT
+// (requests per minute) and INGEST_RATE_BURST
+const (
+	defaultIngestRatePerMinute = 60
+	defaultIngestBurst         = 10
+)
+
+// loadIngestRateLimit reads the ingest rate limit from the environment
+func loadIngestRateLimit() (rate.Limit, int) {
+	perMinute := defaultIngestRatePerMinute
+	if value := os.Getenv("INGEST_RATE_LIMIT"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			perMinute = n
+		} else {
+			slog.Warn("invalid environment variable",
+				slog.String("name", "INGEST_RATE_LIMIT"), slog.String("value", value), slog.Int("using", defaultIngestRatePerMinute))
+		}
+	}
+
+	burst := defaultIngestBurst
+	if value := os.Getenv("INGEST_RATE_BURST"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			burst = n
+		} else {
+			slog.Warn("invalid environment variable",
+				slog.String("name", "INGEST_RATE_BURST"), slog.String("value", value), slog.Int("using", defaultIngestBurst))
+		}
+	}
+
+	return rate.Limit(float64(perMinute) / 60), burst
+}
+
+// ipRateLimiter keeps a token bucket per client IP
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*rateClient
+	lastSweep time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// idleClientTTL is how long an IP's bucket is kept after its last request
+const idleClientTTL = 10 * time.Minute
+
+func newIPRateLimiter(limit rate.Limit, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:   limit,
+		burst:   burst,
+		clients: make(map[string]*rateClient),
+	}
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleClientTTL {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) > idleClientTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &rateClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter.Allow()
+}
+
+// middleware rejects requests over the per-IP limit with a 429
+func (l *ipRateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if !l.allow(ip) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"rate limit exceeded"}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// devAllowedOrigins is the allow-everything CORS fallback used in development
+var devAllowedOrigins = []string{"http://*", "https://*"}
+
+// loadAllowedOrigins reads CORS_ALLOWED_ORIGINS, a comma-separated origin list.
+// When unset, development (APP_ENV=development) allows any origin and other
+// environments allow none, leaving only same-origin requests.
+func loadAllowedOrigins() []string {
+	isDev := os.Getenv("APP_ENV") == "development"
+
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		if isDev {
+			return devAllowedOrigins
+		}
+		slog.Warn("CORS_ALLOWED_ORIGINS not set, cross-origin requests will be rejected")
+		return nil
+	}
+
+	if !isDev {
+		for _, origin := range origins {
+			if strings.Contains(origin, "*") {
+				slog.Warn("CORS_ALLOWED_ORIGINS contains a wildcard in production; credentialed requests "+
+					"from any matching site will be allowed, so list exact origins instead", slog.String("origin", origin))
+			}
+		}
+	}
+	return origins
+}
+
+// denyAllOrigins rejects every cross-origin request. An empty AllowedOrigins
+// would otherwise make the cors middleware allow any origin.
+func denyAllOrigins(r *http.Request, origin string) bool {
+	return false
+}
+
+// loadAPITokens reads API_TOKENS, a comma-separated list of token:user_id
+// pairs. When unset the API runs in single-user mode without authentication,
+// and requireUser keeps the write endpoints closed.
+func loadAPITokens() map[string]string {
+	value := os.Getenv("API_TOKENS")
+	if value == "" {
+		return nil
+	}
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		token, userID, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || token == "" || userID == "" || strings.ContainsAny(userID, "\"\\\n\r") {
+			log.Fatalf("Invalid API_TOKENS entry %q: expected token:user_id", pair)
+		}
+		tokens[token] = userID
+	}
+	return tokens
+}
+
+// authenticate resolves the bearer token to a user and stores the user ID in
+// the request context. With no tokens configured every request passes through.
+func authenticate(tokens map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(tokens) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			userID, known := tokens[token]
+			if !ok || !known {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"missing or invalid API token"}`))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(model.WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// requireUser rejects requests that authenticate didn't resolve to a user, so
+// endpoints that write stored data stay closed when API_TOKENS is unset
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if model.UserIDFromContext(r.Context()) == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"this endpoint requires API_TOKENS to be configured"}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timezone reads the tz query param into the request context so the store
+// renders timestamps in it: "local" (the default) for labels in the server's
+// APP_TIMEZONE, "utc" for ISO 8601 UTC timestamps, or an IANA zone name
+func timezone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tz model.Timezone
+		switch value := r.URL.Query().Get("tz"); strings.ToLower(value) {
+		case "", "local":
+		case "utc":
+			tz.UTC = true
+		default:
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": fmt.Sprintf("invalid tz %q: use local, utc or an IANA zone name", value),
+				})
+				return
+			}
+			tz.Location = loc
+		}
+		next.ServeHTTP(w, r.WithContext(model.WithTimezone(r.Context(), tz)))
+	})
+}
+
+// skipSmallCompression must be registered after middleware.Compress. It holds
+// back the start of each response and, if the handler finishes before minSize
+// bytes are written, sends the body uncompressed by writing past the compressor.
+func skipSmallCompression(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &sizeGateWriter{ResponseWriter: w, minSize: minSize}
+			defer sw.finish()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+type sizeGateWriter struct {
+	http.ResponseWriter
+	minSize   int
+	buf       bytes.Buffer
+	status    int
+	committed bool
+}
+
+func (sw *sizeGateWriter) WriteHeader(code int) {
+	if sw.committed {
+		sw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if sw.status == 0 {
+		sw.status = code
+	}
+}
+
+func (sw *sizeGateWriter) Write(p []byte) (int, error) {
+	if sw.committed {
+		return sw.ResponseWriter.Write(p)
+	}
+	sw.buf.Write(p)
+	if sw.buf.Len() >= sw.minSize {
+		if err := sw.commit(sw.ResponseWriter); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush commits to the (possibly compressing) writer so streamed responses
+// are never held back
+func (sw *sizeGateWriter) Flush() {
+	if !sw.committed {
+		sw.commit(sw.ResponseWriter)
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *sizeGateWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// finish sends a response that never reached minSize straight to the writer
+// beneath the compressor
+func (sw *sizeGateWriter) finish() {
+	if sw.committed {
+		return
+	}
+	w := sw.ResponseWriter
+	if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		w = u.Unwrap()
+	}
+	sw.commit(w)
+}
+
+func (sw *sizeGateWriter) commit(w http.ResponseWriter) error {
+	sw.committed = true
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	w.WriteHeader(sw.status)
+	if sw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.Write(sw.buf.Bytes())
+	sw.buf.Reset()
+	return err
+}
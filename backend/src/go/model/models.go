@@ -1,19 +1,203 @@
 package model
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnknownField is returned when a requested field isn't allowed for a series
+var ErrUnknownField = errors.New("unknown field")
+
+// ErrInvalidPatch is returned when a PATCH can't be applied to the point it targets
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// UserIDTag is the tag that scopes points to a user when API_TOKENS is set
+const UserIDTag = "user_id"
+
+type userIDKey struct{}
+
+// WithUserID returns a context carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID, or "" in single-user mode
+func UserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+// Timezone is how a request wants timestamps rendered, chosen by the tz query
+// param. UTC renders readings as ISO 8601 UTC timestamps and days as
+// YYYY-MM-DD; otherwise display labels are rendered in Location, or in the
+// server's APP_TIMEZONE when Location is nil.
+type Timezone struct {
+	UTC      bool
+	Location *time.Location
+}
+
+// String identifies the rendering, e.g. for cache keys
+func (tz Timezone) String() string {
+	switch {
+	case tz.UTC:
+		return "utc"
+	case tz.Location != nil:
+		return tz.Location.String()
+	default:
+		return "local"
+	}
+}
+
+type timezoneKey struct{}
+
+// WithTimezone returns a context carrying the requested timestamp rendering
+func WithTimezone(ctx context.Context, tz Timezone) context.Context {
+	return context.WithValue(ctx, timezoneKey{}, tz)
+}
+
+// TimezoneFromContext returns the requested rendering, the zero Timezone
+// (server-local labels) if none was set
+func TimezoneFromContext(ctx context.Context) Timezone {
+	tz, _ := ctx.Value(timezoneKey{}).(Timezone)
+	return tz
+}
+
+// Units selects the measurement system used for output values
+type Units string
+
+const (
+	UnitsMetric   Units = "metric" // Stored units: kg, °C, km
+	UnitsImperial Units = "imperial"
+)
+
+// Interval selects how daily rows are grouped into averaged buckets
+type Interval string
+
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week" // Weeks start on Monday
+	IntervalMonth Interval = "month"
+)
+
+// KgToLbs converts kilograms to pounds
+func KgToLbs(kg float64) float64 {
+	return kg * 2.20462262185
+}
+
+// KmToMiles converts kilometres to miles
+func KmToMiles(km float64) float64 {
+	return km / 1.609344
+}
+
+// CelsiusToFahrenheit converts degrees Celsius to degrees Fahrenheit
+func CelsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
+
+// Precision is the unit ingest timestamps are written in. Coarser precisions
+// truncate, so repeated writes of the same second-resolution reading collide.
+type Precision string
+
+const (
+	PrecisionSecond      Precision = "s"
+	PrecisionMillisecond Precision = "ms"
+	PrecisionMicrosecond Precision = "us"
+	PrecisionNanosecond  Precision = "ns"
+)
 
 // IngestRequest is the structure for the /api/v1/ingest endpoint
 type IngestRequest struct {
-	Metrics []Metric `json:"metrics"`
+	Metrics   []Metric  `json:"metrics"`
+	Precision Precision `json:"precision,omitempty"` // Defaults to ns
 }
 
+// FieldType hints how a numeric field is written. JSON decodes every number as
+// a float, so without a hint integers are written as float fields.
+type FieldType string
+
+const (
+	FieldTypeFloat   FieldType = "float"
+	FieldTypeInteger FieldType = "integer"
+)
+
 type Metric struct {
 	Measurement string                 `json:"measurement"`
 	Tags        map[string]string      `json:"tags"`
 	Fields      map[string]interface{} `json:"fields"`
+	FieldTypes  map[string]FieldType   `json:"fieldTypes,omitempty"` // Optional per-field type hints
 	Timestamp   time.Time              `json:"timestamp"`
 }
 
+// PatchResult is the response to PATCH /api/v1/metrics, listing each patched
+// field with its value before and after. Old is null for a field the point
+// didn't have.
+type PatchResult struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Changes     []FieldChange     `json:"changes"`
+}
+
+// FieldChange is one field overwritten by a PATCH
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// MetricError describes why a single metric in an ingest request was rejected
+type MetricError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// IngestResult is the 202 response body for /api/v1/ingest. With DryRun set,
+// Written counts the points that would have been written.
+type IngestResult struct {
+	Written int      `json:"written"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+	// Rejected lists metrics dropped for implausible values; they count as skipped
+	Rejected []MetricError `json:"rejected,omitempty"`
+	DryRun   bool          `json:"dryRun,omitempty"`
+}
+
+// IngestProgress is one line of the NDJSON response to a streamed ingest.
+// Lines, Written and Skipped are running totals; Errors holds only the
+// rejections since the previous line. The last line has Done set.
+type IngestProgress struct {
+	Lines   int      `json:"lines"`
+	Written int      `json:"written"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+	Done    bool     `json:"done"`
+	Error   string   `json:"error,omitempty"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+}
+
+// SyncStatus is the structure for the /api/v1/status/last-sync endpoint.
+// LastSync is the newest point across all measurements, nil before any data.
+type SyncStatus struct {
+	LastSync     *time.Time        `json:"last_sync"`
+	Measurements []MeasurementSync `json:"measurements"`
+}
+
+// MeasurementSync is the newest point written to one measurement
+type MeasurementSync struct {
+	Measurement string    `json:"measurement"`
+	LastSync    time.Time `json:"last_sync"`
+}
+
+// IngestValidationError is the 400 response body for an invalid ingest request
+type IngestValidationError struct {
+	Error   string        `json:"error"`
+	Metrics []MetricError `json:"metrics"`
+}
+
 // Summary is the structure for the /api/v1/summary endpoint
 type Summary struct {
 	Steps           int     `json:"steps"`
@@ -21,6 +205,16 @@ type Summary struct {
 	ActiveCalories  float64 `json:"activeCalories"`
 	BasalCalories   float64 `json:"basalCalories"`
 	DietaryCalories float64 `json:"dietaryCalories"`
+	NetCalories     float64 `json:"netCalories"` // Dietary minus active and basal; negative is a deficit
+	// RestingHR is the synced resting heart rate, or the lowest rolling
+	// average during sleep; omitted when there's no heart rate for the day
+	RestingHR float64 `json:"restingHR,omitempty"`
+	// Goals come from STEP_GOAL / CALORIE_GOAL and are omitted when unset.
+	// Progress is a percentage and may exceed 100.
+	StepGoal         int      `json:"stepGoal,omitempty"`
+	CalorieGoal      float64  `json:"calorieGoal,omitempty"`
+	StepsProgress    *float64 `json:"stepsProgress,omitempty"`
+	CaloriesProgress *float64 `json:"caloriesProgress,omitempty"`
 }
 
 // TimeSeriesValue is a generic struct for time series data
@@ -29,6 +223,45 @@ type TimeSeriesValue struct {
 	Value float64 `json:"value"`
 }
 
+// DefaultHRBucket is the heart rate aggregation interval used when none is requested
+const DefaultHRBucket = 10 * time.Minute
+
+// HROptions controls how the /api/v1/vitals/hr endpoint shapes its output
+type HROptions struct {
+	Raw    bool          // Return every reading with full timestamps instead of bucketed averages
+	Bucket time.Duration // Aggregation interval, DefaultHRBucket when zero
+	// MaxPoints caps the series length by widening Bucket, bucketing raw
+	// readings too when there are more; zero means no cap
+	MaxPoints int
+}
+
+// HRBucket is one point of the /api/v1/vitals/hr series. Value is the bucket
+// average; Min and Max are omitted for raw readings.
+type HRBucket struct {
+	Time  string   `json:"time"`
+	Value float64  `json:"value"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// HRDailyStat is the structure for the /api/v1/vitals/hr/daily endpoint
+type HRDailyStat struct {
+	Date    string   `json:"date"`
+	Min     float64  `json:"min"`
+	Max     float64  `json:"max"`
+	Avg     float64  `json:"avg"`
+	Resting *float64 `json:"resting,omitempty"`
+}
+
+// BPStandard selects the guideline used to categorize blood pressure readings
+type BPStandard string
+
+const (
+	BPStandardACCAHA BPStandard = "acc_aha" // ACC/AHA 2017, the default
+	BPStandardESC    BPStandard = "esc"     // ESC/ESH 2018
+	BPStandardJNC7   BPStandard = "jnc7"
+)
+
 // BloodPressure is the structure for blood pressure data
 type BloodPressure struct {
 	Time      string `json:"time"`
@@ -43,6 +276,37 @@ type Glucose struct {
 	Value float64 `json:"value"`
 }
 
+// GlucoseDaily is one day of the /api/v1/vitals/glucose?aggregate=daily series
+type GlucoseDaily struct {
+	Date  string  `json:"date"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Count int     `json:"count"` // Readings that day
+}
+
+// DefaultGlucoseRange is the consensus 70–180 mg/dL target range
+var DefaultGlucoseRange = GlucoseRange{Low: 70, High: 180}
+
+// GlucoseRange is an inclusive target range in mg/dL
+type GlucoseRange struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// GlucoseStats is the structure for the /api/v1/vitals/glucose/stats endpoint.
+// Derived values are nil when there are no readings; percentages are 0–100.
+type GlucoseStats struct {
+	Readings       int          `json:"readings"`
+	Range          GlucoseRange `json:"range"`
+	Average        *float64     `json:"average"`
+	StdDev         *float64     `json:"stdDev"`
+	GMI            *float64     `json:"gmi"`
+	TimeInRange    *float64     `json:"timeInRange"`
+	TimeBelowRange *float64     `json:"timeBelowRange"`
+	TimeAboveRange *float64     `json:"timeAboveRange"`
+}
+
 // Sleep is the structure for sleep data
 type Sleep struct {
 	Date            string  `json:"date"`
@@ -52,6 +316,16 @@ type Sleep struct {
 	LightSleep      float64 `json:"lightSleep"`
 	Awake           float64 `json:"awake"`
 	Efficiency      float64 `json:"efficiency"`
+	Nights          int     `json:"nights,omitempty"` // Nights averaged into a week/month bucket
+}
+
+// SleepStageSegment is one stretch of a single sleep stage in the
+// /api/v1/sleep/stages hypnogram. Stage is one of awake, rem, core, deep or
+// asleep (for devices that don't distinguish stages).
+type SleepStageSegment struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Stage string    `json:"stage"`
 }
 
 // Workout is the structure for workout data
@@ -63,16 +337,136 @@ type Workout struct {
 	Calories  float64 `json:"calories"`
 	Type      string  `json:"type"`
 	AvgHr     int     `json:"avgHr"`
+	// Distance is in km and Pace in minutes per km (miles and minutes per
+	// mile with units=imperial); both are omitted for workouts without distance
+	Distance float64 `json:"distance,omitempty"`
+	Pace     float64 `json:"pace,omitempty"`
+}
+
+// WorkoutDetail is the structure for the /api/v1/workouts/{id} endpoint.
+// AvgHr, MinHr and MaxHr are computed from HeartRate. Zones is omitted when no
+// max heart rate is known.
+type WorkoutDetail struct {
+	Workout
+	MinHr     float64           `json:"minHr"`
+	MaxHr     float64           `json:"maxHr"`
+	HeartRate []TimeSeriesValue `json:"heartRate"`
+	Zones     []HRZoneTime      `json:"zones,omitempty"`
+}
+
+// DefaultHRZoneBounds are the lower bounds of zones 1–5 in percent of max HR
+var DefaultHRZoneBounds = [5]float64{50, 60, 70, 80, 90}
+
+// HRZones classifies heart rates into zones 1–5. Bounds are each zone's lower
+// bound in percent of MaxHR, ascending; a zero MaxHR disables zones.
+type HRZones struct {
+	MaxHR  float64
+	Bounds [5]float64
+}
+
+// HRZoneTime is the time a workout spent in one heart rate zone. MaxBPM is 0
+// for zone 5, which has no upper bound.
+type HRZoneTime struct {
+	Zone    int     `json:"zone"`
+	MinBPM  float64 `json:"minBpm"`
+	MaxBPM  float64 `json:"maxBpm,omitempty"`
+	Seconds int     `json:"seconds"`
 }
 
+// WorkoutWeek is the structure for the /api/v1/workouts/weekly endpoint.
+// Duration is in minutes.
+type WorkoutWeek struct {
+	Week      string  `json:"week"`      // ISO week, e.g. 2026-W07
+	StartDate string  `json:"startDate"` // Monday of the week
+	Duration  int     `json:"duration"`
+	Calories  float64 `json:"calories"`
+	Count     int     `json:"count"`
+}
+
+// Pagination holds limit/offset paging parameters; a zero Limit means no limit
+type Pagination struct {
+	Limit  int
+	Offset int
+}
+
+// WorkoutPage is the paginated structure for the /api/v1/workouts endpoint
+type WorkoutPage struct {
+	Workouts []Workout `json:"workouts"`
+	Total    int       `json:"total"`
+	Offset   int       `json:"offset"`
+}
+
+// ListResponse is the envelope list endpoints wrap their rows in
+type ListResponse[T any] struct {
+	Data []T      `json:"data"`
+	Meta ListMeta `json:"meta"`
+}
+
+// ListMeta describes a list response. Start and Stop are the bounds the query
+// actually covered once default windows were applied. Total counts every
+// matching row and Offset the rows skipped before Data, as in WorkoutPage.
+type ListMeta struct {
+	Start  string `json:"start"`
+	Stop   string `json:"stop"`
+	Count  int    `json:"count"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+}
+
+// ListKind names a list endpoint whose default window ListRange resolves
+type ListKind string
+
+const (
+	ListBloodPressure ListKind = "bp"
+	ListGlucose       ListKind = "glucose"
+	ListSleep         ListKind = "sleep"
+	ListSleepWeekly   ListKind = "sleep-week"
+	ListSleepMonthly  ListKind = "sleep-month"
+	ListWorkouts      ListKind = "workouts"
+)
+
+// DefaultTrendWindow is the rolling-average window, in days, for dietary trends
+const DefaultTrendWindow = 7
+
 // DietaryTrend is the structure for dietary trend data
 type DietaryTrend struct {
+	Date         string  `json:"date"`
+	Calories     float64 `json:"calories"`
+	Protein      float64 `json:"protein"`
+	Carbs        float64 `json:"carbs"`
+	Fat          float64 `json:"fat"`
+	Trend        float64 `json:"trend"` // Rolling average of calories
+	ProteinTrend float64 `json:"proteinTrend"`
+	CarbsTrend   float64 `json:"carbsTrend"`
+	FatTrend     float64 `json:"fatTrend"`
+}
+
+// DietaryTotals is the structure for the /api/v1/dietary/totals endpoint
+type DietaryTotals struct {
 	Date     string  `json:"date"`
 	Calories float64 `json:"calories"`
 	Protein  float64 `json:"protein"`
 	Carbs    float64 `json:"carbs"`
 	Fat      float64 `json:"fat"`
-	Trend    float64 `json:"trend"`
+}
+
+// MacroBreakdown is the structure for the /api/v1/dietary/macros-breakdown
+// endpoint. Calories is the energy from the three macros, which each macro's
+// Percent is a share of, so the percentages sum to 100 (or are all zero on a
+// day with no dietary data).
+type MacroBreakdown struct {
+	Date     string     `json:"date"`
+	Calories float64    `json:"calories"`
+	Protein  MacroShare `json:"protein"`
+	Carbs    MacroShare `json:"carbs"`
+	Fat      MacroShare `json:"fat"`
+}
+
+// MacroShare is one macro's grams and the calories and percentage they supply
+type MacroShare struct {
+	Grams    float64 `json:"grams"`
+	Calories float64 `json:"calories"`
+	Percent  float64 `json:"percent"`
 }
 
 // Meal is the structure for meal data
@@ -90,4 +484,29 @@ type BodyComposition struct {
 	Weight     float64 `json:"weight"`
 	BodyFat    float64 `json:"body_fat"`
 	MuscleMass float64 `json:"muscle_mass"` // Added missing field
+	// TrendWeight is a 7-day exponentially weighted moving average of weight
+	TrendWeight float64 `json:"trend_weight"`
+	// Direction is "up", "down" or "flat" from the least-squares weight slope
+	// across the whole returned window, so it's the same on every row; omitted
+	// with fewer than two readings
+	Direction string `json:"direction,omitempty"`
+	// WeightStdDev is the population standard deviation of weight across the
+	// returned window, also the same on every row
+	WeightStdDev float64 `json:"weight_stddev"`
+}
+
+// Dashboard is the structure for the /api/v1/dashboard endpoint. Sections that
+// failed to load are left empty and listed in Errors.
+type Dashboard struct {
+	Date            string            `json:"date"`
+	Summary         *Summary          `json:"summary"`
+	HeartRate       []HRBucket        `json:"heartRate"`
+	BloodPressure   []BloodPressure   `json:"bloodPressure"`
+	Glucose         []Glucose         `json:"glucose"`
+	Sleep           []Sleep           `json:"sleep"`
+	Workouts        []Workout         `json:"workouts"`
+	DietaryTrends   []DietaryTrend    `json:"dietaryTrends"`
+	Meals           []Meal            `json:"meals"`
+	BodyComposition []BodyComposition `json:"bodyComposition"`
+	Errors          map[string]string `json:"errors,omitempty"`
 }
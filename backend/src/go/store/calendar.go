@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"health_app/api/model"
+)
+
+// GetDatesWithData returns the local days (YYYY-MM-DD in APP_TIMEZONE) from
+// start to end inclusive that have at least one point in measurement. Only
+// the calendar dates of start and end are used. It returns model.ErrNotFound
+// for a measurement that has never been written.
+func (s *InfluxDBStore) GetDatesWithData(ctx context.Context, measurement string, start, end time.Time) ([]string, error) {
+	existing, err := s.GetMeasurements(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(existing, measurement) {
+		return nil, model.ErrNotFound
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	startLocal := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, s.loc)
+	stopLocal := time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, s.loc)
+	// Binning to 15 minutes keeps the row count small while every bin still
+	// falls in a single local day for any real UTC offset. The name was just
+	// checked against the database's own tables.
+	sqlQuery := fmt.Sprintf(`
+SELECT DISTINCT date_bin(INTERVAL '15 minutes', time) AS bin
+FROM "%s"
+WHERE time >= $start AND time < $stop`, measurement)
+
+	params := rangeParams(startLocal.UTC().Format(time.RFC3339), stopLocal.UTC().Format(time.RFC3339))
+	result, err := s.query(ctx, sqlQuery, params)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	dates := []string{}
+	for result.Next() {
+		t, ok := result.Value()["bin"].(time.Time)
+		if !ok {
+			continue
+		}
+		if day := t.In(s.loc).Format("2006-01-02"); !seen[day] {
+			seen[day] = true
+			dates = append(dates, day)
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	slices.Sort(dates)
+	return dates, nil
+}
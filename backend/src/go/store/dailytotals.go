@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"health_app/api/model"
+
+	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
+)
+
+// dailyTotalMetrics are the raw measurements rolled up into daily_totals, each
+// written as a row tagged with the measurement name as its metric
+var dailyTotalMetrics = []string{
+	"active_energy", "basal_energy_burned", "step_count", "walking_running_distance",
+}
+
+// RecomputeDailyTotals sums the day's raw step, energy and distance readings
+// per source and writes them to daily_totals at local midnight, so a day the
+// external rollup missed can be backfilled. Recomputing a day again replaces
+// the rows written the first time.
+func (s *InfluxDBStore) RecomputeDailyTotals(ctx context.Context, date string) error {
+	existing, err := s.GetMeasurements(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	start, stop := getDayRangeUTC(date, s.loc)
+
+	// As in GetLastIngestTime, a missing table would fail the whole UNION
+	var selects []string
+	for _, measurement := range dailyTotalMetrics {
+		if slices.Contains(existing, measurement) {
+			selects = append(selects, fmt.Sprintf(`SELECT '%s' AS metric, source, sum(qty) AS value
+FROM "%s"
+WHERE time >= $start AND time < $stop
+GROUP BY source`, measurement, measurement))
+		}
+	}
+	if len(selects) == 0 {
+		return nil
+	}
+
+	result, err := s.query(ctx, strings.Join(selects, "\nUNION ALL\n"), rangeParams(start, stop))
+	if err != nil {
+		return err
+	}
+
+	midnight, _ := time.Parse(time.RFC3339, start)
+	userID := model.UserIDFromContext(ctx)
+	var points []*influxdb3.Point
+	for result.Next() {
+		record := result.Value()
+		metric, _ := record["metric"].(string)
+		source, _ := record["source"].(string)
+
+		var value float64
+		switch v := record["value"].(type) {
+		case float64:
+			value = v
+		case int64:
+			value = float64(v)
+		default:
+			continue
+		}
+
+		point := influxdb3.NewPointWithMeasurement("daily_totals").
+			SetTag("metric", metric).
+			SetDoubleField("value", value).
+			SetStringField("date", date).
+			SetTimestamp(midnight)
+		if source != "" {
+			point.SetTag("source", source)
+		}
+		if userID != "" {
+			point.SetTag(model.UserIDTag, userID)
+		}
+		points = append(points, point)
+	}
+	if result.Err() != nil {
+		return result.Err()
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	return s.writeWithRetry(ctx, func(client *influxdb3.Client) error {
+		return client.WritePoints(ctx, points)
+	})
+}
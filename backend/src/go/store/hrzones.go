@@ -0,0 +1,61 @@
+package store
+
+import (
+	"math"
+	"time"
+
+	"health_app/api/model"
+)
+
+// maxZoneSampleGap caps the time credited to one heart rate sample, so a
+// pause or dropout isn't counted as time in the zone of the sample before it
+const maxZoneSampleGap = 5 * time.Minute
+
+// hrSample is one heart rate reading
+type hrSample struct {
+	time  time.Time
+	value float64
+}
+
+// hrZone returns the zone (1–5) bpm falls in, or 0 below zone 1. A reading
+// exactly on a bound belongs to the higher zone.
+func hrZone(bpm float64, zones model.HRZones) int {
+	percent := bpm / zones.MaxHR * 100
+	for zone := len(zones.Bounds); zone > 0; zone-- {
+		if percent >= zones.Bounds[zone-1] {
+			return zone
+		}
+	}
+	return 0
+}
+
+// workoutZones totals the seconds spent in each zone. Each sample counts until
+// the next one, capped at maxZoneSampleGap; the last sample counts for the
+// same gap as the one before it.
+func workoutZones(samples []hrSample, zones model.HRZones) []model.HRZoneTime {
+	if zones.MaxHR <= 0 {
+		return nil
+	}
+	result := make([]model.HRZoneTime, len(zones.Bounds))
+	for i, bound := range zones.Bounds {
+		result[i] = model.HRZoneTime{Zone: i + 1, MinBPM: math.Round(bound * zones.MaxHR / 100)}
+		if i+1 < len(zones.Bounds) {
+			result[i].MaxBPM = math.Round(zones.Bounds[i+1] * zones.MaxHR / 100)
+		}
+	}
+
+	var seconds [len(zones.Bounds)]float64
+	var gap time.Duration
+	for i, sample := range samples {
+		if i+1 < len(samples) {
+			gap = min(samples[i+1].time.Sub(sample.time), maxZoneSampleGap)
+		}
+		if zone := hrZone(sample.value, zones); zone > 0 {
+			seconds[zone-1] += gap.Seconds()
+		}
+	}
+	for i := range result {
+		result[i].Seconds = int(math.Round(seconds[i]))
+	}
+	return result
+}
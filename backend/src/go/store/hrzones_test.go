@@ -0,0 +1,105 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"health_app/api/model"
+)
+
+func TestHRZone(t *testing.T) {
+	zones := model.HRZones{MaxHR: 200, Bounds: model.DefaultHRZoneBounds}
+	tests := []struct {
+		bpm  float64
+		want int
+	}{
+		{bpm: 0, want: 0},
+		{bpm: 99.9, want: 0},
+		{bpm: 100, want: 1}, // A bound belongs to the zone above it
+		{bpm: 119.9, want: 1},
+		{bpm: 120, want: 2},
+		{bpm: 140, want: 3},
+		{bpm: 160, want: 4},
+		{bpm: 179.9, want: 4},
+		{bpm: 180, want: 5},
+		{bpm: 215, want: 5}, // Above max HR stays in the top zone
+	}
+	for _, tt := range tests {
+		if got := hrZone(tt.bpm, zones); got != tt.want {
+			t.Errorf("hrZone(%v) = %d, want %d", tt.bpm, got, tt.want)
+		}
+	}
+}
+
+func TestWorkoutZones(t *testing.T) {
+	start := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration, bpm float64) hrSample {
+		return hrSample{time: start.Add(offset), value: bpm}
+	}
+	zones := model.HRZones{MaxHR: 200, Bounds: model.DefaultHRZoneBounds}
+	tests := []struct {
+		name        string
+		samples     []hrSample
+		zones       model.HRZones
+		wantSeconds []int // Per zone, nil when zones are disabled
+	}{
+		{
+			name:        "each sample counts until the next",
+			samples:     []hrSample{at(0, 100), at(time.Minute, 130), at(3*time.Minute, 170)},
+			zones:       zones,
+			wantSeconds: []int{60, 120, 0, 120, 0},
+		},
+		{
+			name:        "gaps are capped",
+			samples:     []hrSample{at(0, 185), at(20*time.Minute, 150)},
+			zones:       zones,
+			wantSeconds: []int{0, 0, 300, 0, 300},
+		},
+		{
+			name:        "below zone 1 isn't counted",
+			samples:     []hrSample{at(0, 80), at(time.Minute, 95), at(2*time.Minute, 100)},
+			zones:       zones,
+			wantSeconds: []int{60, 0, 0, 0, 0},
+		},
+		{
+			name:        "no samples",
+			zones:       zones,
+			wantSeconds: []int{0, 0, 0, 0, 0},
+		},
+		{
+			name:    "no max HR",
+			samples: []hrSample{at(0, 150), at(time.Minute, 150)},
+			zones:   model.HRZones{Bounds: model.DefaultHRZoneBounds},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := workoutZones(tt.samples, tt.zones)
+			if tt.wantSeconds == nil {
+				if got != nil {
+					t.Errorf("got %+v, want no zones", got)
+				}
+				return
+			}
+			if len(got) != len(tt.wantSeconds) {
+				t.Fatalf("got %d zones, want %d", len(got), len(tt.wantSeconds))
+			}
+			for i, zone := range got {
+				if zone.Zone != i+1 || zone.Seconds != tt.wantSeconds[i] {
+					t.Errorf("zone %d = %+v, want zone %d with %ds", i, zone, i+1, tt.wantSeconds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWorkoutZonesBPMBounds(t *testing.T) {
+	zones := model.HRZones{MaxHR: 185, Bounds: model.DefaultHRZoneBounds}
+	got := workoutZones(nil, zones)
+	want := [][2]float64{{93, 111}, {111, 130}, {130, 148}, {148, 167}, {167, 0}}
+	for i, zone := range got {
+		if zone.MinBPM != want[i][0] || zone.MaxBPM != want[i][1] {
+			t.Errorf("zone %d spans %v–%v bpm, want %v–%v", zone.Zone, zone.MinBPM, zone.MaxBPM, want[i][0], want[i][1])
+		}
+	}
+}
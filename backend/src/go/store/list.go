@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"health_app/api/model"
+)
+
+// ListRange returns the bounds a list endpoint queries for the given dates,
+// applying the same default window as the endpoint's store method. The bounds
+// are rendered as RFC 3339 timestamps in the request's tz.
+func (s *InfluxDBStore) ListRange(ctx context.Context, list model.ListKind, startDate, endDate string) model.ListMeta {
+	var defaultDays int
+	switch list {
+	case model.ListBloodPressure:
+		defaultDays = s.windows.BloodPressure
+	case model.ListGlucose:
+		defaultDays = s.windows.Glucose
+	case model.ListSleep:
+		defaultDays = s.sleepWindowDays(model.IntervalDay)
+	case model.ListSleepWeekly:
+		defaultDays = s.sleepWindowDays(model.IntervalWeek)
+	case model.ListSleepMonthly:
+		defaultDays = s.sleepWindowDays(model.IntervalMonth)
+	case model.ListWorkouts:
+		defaultDays = s.windows.Workouts
+	}
+
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, defaultDays, s.loc)
+	return model.ListMeta{
+		Start: renderBound(tf, start),
+		Stop:  renderBound(tf, stop),
+	}
+}
+
+// renderBound re-renders a UTC query bound in the response's zone
+func renderBound(tf timeFormat, bound string) string {
+	t, err := time.Parse(time.RFC3339, bound)
+	if err != nil {
+		return bound
+	}
+	return tf.in(t).Format(time.RFC3339)
+}
@@ -0,0 +1,479 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"health_app/api/model"
+)
+
+// MemoryStore is an in-memory implementation of the handler Store interface
+// for tests. Seed the exported fields directly; Get methods return the seeded
+// data without applying date ranges. Setting Err makes every method fail.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	Err error
+
+	Metrics         []model.Metric // Everything passed to Ingest
+	Recomputed      []string       // Dates passed to RecomputeDailyTotals
+	Summaries       map[string]*model.Summary
+	Sources         []string
+	Measurements    []string
+	HR              []model.HRBucket
+	HRDailyStats    []model.HRDailyStat
+	Steps           []model.TimeSeriesValue
+	ActiveEnergy    []model.TimeSeriesValue
+	Distance        []model.TimeSeriesValue
+	BloodPressure   []model.BloodPressure
+	Glucose         []model.Glucose
+	GlucoseDaily    []model.GlucoseDaily
+	Spo2            []model.TimeSeriesValue
+	HRV             []model.TimeSeriesValue
+	RespiratoryRate []model.TimeSeriesValue
+	VO2Max          []model.TimeSeriesValue
+	RestingHR       []model.TimeSeriesValue
+	Sleep           []model.Sleep
+	SleepStages     []model.SleepStageSegment
+	Workouts        []model.Workout
+	WorkoutDetails  map[string]*model.WorkoutDetail
+	DietaryTrends   []model.DietaryTrend
+	DietaryTotals   map[string]*model.DietaryTotals
+	Meals           []model.Meal
+	BodyComposition []model.BodyComposition
+	Weight          []model.TimeSeriesValue
+	BodyFat         []model.TimeSeriesValue
+	BodyTemperature []model.TimeSeriesValue
+	Vitals          map[string][]model.TimeSeriesValue            // Keyed by vital name
+	VitalFields     map[string]map[string][]model.TimeSeriesValue // Keyed by vital name, then field
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Summaries:      make(map[string]*model.Summary),
+		WorkoutDetails: make(map[string]*model.WorkoutDetail),
+		DietaryTotals:  make(map[string]*model.DietaryTotals),
+		Vitals:         make(map[string][]model.TimeSeriesValue),
+		VitalFields:    make(map[string]map[string][]model.TimeSeriesValue),
+	}
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Err
+}
+
+// Ingest records metrics with timestamps truncated to precision, as InfluxDB
+// would store them
+func (m *MemoryStore) Ingest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	resolution := map[model.Precision]time.Duration{
+		model.PrecisionSecond:      time.Second,
+		model.PrecisionMillisecond: time.Millisecond,
+		model.PrecisionMicrosecond: time.Microsecond,
+	}[precision]
+	for _, metric := range metrics {
+		if resolution > 0 {
+			metric.Timestamp = metric.Timestamp.Truncate(resolution)
+		}
+		m.Metrics = append(m.Metrics, metric)
+	}
+	return &model.IngestResult{Written: len(metrics)}, nil
+}
+
+// ValidateIngest reports what Ingest would write without recording anything
+func (m *MemoryStore) ValidateIngest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &model.IngestResult{Written: len(metrics), DryRun: true}, nil
+}
+
+func (m *MemoryStore) RecomputeDailyTotals(ctx context.Context, date string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Recomputed = append(m.Recomputed, date)
+	return nil
+}
+
+// PatchMetric overwrites fields of the ingested metric with the same
+// measurement, tags and timestamp
+func (m *MemoryStore) PatchMetric(ctx context.Context, patch model.Metric) (*model.PatchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	for i, metric := range m.Metrics {
+		if metric.Measurement != patch.Measurement || !maps.Equal(metric.Tags, patch.Tags) || !metric.Timestamp.Equal(patch.Timestamp) {
+			continue
+		}
+		result := &model.PatchResult{Measurement: patch.Measurement, Tags: patch.Tags, Timestamp: patch.Timestamp}
+		fields := maps.Clone(metric.Fields)
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+		for _, field := range slices.Sorted(maps.Keys(patch.Fields)) {
+			result.Changes = append(result.Changes, model.FieldChange{Field: field, Old: fields[field], New: patch.Fields[field]})
+			fields[field] = patch.Fields[field]
+		}
+		m.Metrics[i].Fields = fields
+		return result, nil
+	}
+	return nil, model.ErrNotFound
+}
+
+// GetSummary returns the summary seeded for date, or an empty summary
+func (m *MemoryStore) GetSummary(ctx context.Context, date, source string) (*model.Summary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if summary, ok := m.Summaries[date]; ok {
+		copied := *summary
+		return &copied, nil
+	}
+	return &model.Summary{}, nil
+}
+
+func (m *MemoryStore) GetSources(ctx context.Context) ([]string, error) {
+	return memoryList(m, func() []string { return m.Sources })
+}
+
+func (m *MemoryStore) GetMeasurements(ctx context.Context) ([]string, error) {
+	return memoryList(m, func() []string { return m.Measurements })
+}
+
+// GetDatesWithData returns the UTC days in start to end inclusive with an
+// ingested metric in measurement, or model.ErrNotFound if there are none at all
+func (m *MemoryStore) GetDatesWithData(ctx context.Context, measurement string, start, end time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	first, last := start.Format("2006-01-02"), end.Format("2006-01-02")
+	found := false
+	dates := []string{}
+	for _, metric := range m.Metrics {
+		if metric.Measurement != measurement {
+			continue
+		}
+		found = true
+		day := metric.Timestamp.UTC().Format("2006-01-02")
+		if day >= first && day <= last && !slices.Contains(dates, day) {
+			dates = append(dates, day)
+		}
+	}
+	if !found {
+		return nil, model.ErrNotFound
+	}
+	slices.Sort(dates)
+	return dates, nil
+}
+
+// GetLastIngestTime reports the newest timestamp among ingested metrics
+func (m *MemoryStore) GetLastIngestTime(ctx context.Context) (*model.SyncStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	latest := make(map[string]time.Time)
+	for _, metric := range m.Metrics {
+		if metric.Timestamp.After(latest[metric.Measurement]) {
+			latest[metric.Measurement] = metric.Timestamp
+		}
+	}
+	status := &model.SyncStatus{Measurements: []model.MeasurementSync{}}
+	for _, measurement := range slices.Sorted(maps.Keys(latest)) {
+		t := latest[measurement]
+		status.Measurements = append(status.Measurements, model.MeasurementSync{Measurement: measurement, LastSync: t})
+		if status.LastSync == nil || t.After(*status.LastSync) {
+			status.LastSync = &t
+		}
+	}
+	return status, nil
+}
+
+func (m *MemoryStore) GetVitalsHR(ctx context.Context, date string, opts model.HROptions) ([]model.HRBucket, error) {
+	return memoryList(m, func() []model.HRBucket { return m.HR })
+}
+
+// GetLatestHR returns the last seeded heart rate bucket
+func (m *MemoryStore) GetLatestHR(ctx context.Context) (*model.HRBucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if len(m.HR) == 0 {
+		return nil, model.ErrNotFound
+	}
+	latest := m.HR[len(m.HR)-1]
+	return &latest, nil
+}
+
+func (m *MemoryStore) GetHRDailyStats(ctx context.Context, startDate, endDate string) ([]model.HRDailyStat, error) {
+	return memoryList(m, func() []model.HRDailyStat { return m.HRDailyStats })
+}
+
+func (m *MemoryStore) GetStepsSeries(ctx context.Context, date string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.Steps })
+}
+
+func (m *MemoryStore) GetActiveEnergySeries(ctx context.Context, date, source string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.ActiveEnergy })
+}
+
+func (m *MemoryStore) GetDistanceSeries(ctx context.Context, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.Distance })
+}
+
+// ListRange echoes the requested dates, as the memory store has no windows
+func (m *MemoryStore) ListRange(ctx context.Context, list model.ListKind, startDate, endDate string) model.ListMeta {
+	return model.ListMeta{Start: startDate, Stop: endDate}
+}
+
+func (m *MemoryStore) GetVitalsBP(ctx context.Context, startDate, endDate string, standard model.BPStandard) ([]model.BloodPressure, error) {
+	return memoryList(m, func() []model.BloodPressure { return m.BloodPressure })
+}
+
+func (m *MemoryStore) GetVitalsGlucose(ctx context.Context, startDate, endDate string) ([]model.Glucose, error) {
+	return memoryList(m, func() []model.Glucose { return m.Glucose })
+}
+
+func (m *MemoryStore) GetGlucoseDaily(ctx context.Context, startDate, endDate string) ([]model.GlucoseDaily, error) {
+	return memoryList(m, func() []model.GlucoseDaily { return m.GlucoseDaily })
+}
+
+func (m *MemoryStore) GetGlucoseStats(ctx context.Context, startDate, endDate string, target model.GlucoseRange) (*model.GlucoseStats, error) {
+	glucoses, err := memoryList(m, func() []model.Glucose { return m.Glucose })
+	if err != nil {
+		return nil, err
+	}
+	return glucoseStats(glucoses, target), nil
+}
+
+func (m *MemoryStore) GetVitalsSpo2(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.Spo2 })
+}
+
+func (m *MemoryStore) GetVitalsHRV(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.HRV })
+}
+
+func (m *MemoryStore) GetVitalsRespiratoryRate(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.RespiratoryRate })
+}
+
+func (m *MemoryStore) GetBodyTemperature(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.BodyTemperature })
+}
+
+// GetVital returns the seeded series for metric, or model.ErrNotFound if none
+// was seeded
+func (m *MemoryStore) GetVital(ctx context.Context, metric, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	values, ok := m.Vitals[metric]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	return slices.Clone(values), nil
+}
+
+// GetVitalFields returns the seeded series for each of fields, or
+// model.ErrNotFound if nothing was seeded for metric
+func (m *MemoryStore) GetVitalFields(ctx context.Context, metric string, fields []string, startDate, endDate string) (map[string][]model.TimeSeriesValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	seeded, ok := m.VitalFields[metric]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	series := make(map[string][]model.TimeSeriesValue, len(fields))
+	for _, field := range fields {
+		values, ok := seeded[field]
+		if !ok {
+			return nil, fmt.Errorf("%w %q for vital %q", model.ErrUnknownField, field, metric)
+		}
+		series[field] = slices.Clone(values)
+	}
+	return series, nil
+}
+
+func (m *MemoryStore) GetVitalsVO2Max(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.VO2Max })
+}
+
+func (m *MemoryStore) GetRestingHR(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.RestingHR })
+}
+
+func (m *MemoryStore) GetSleep(ctx context.Context, startDate, endDate string, interval model.Interval) ([]model.Sleep, error) {
+	return memoryList(m, func() []model.Sleep { return m.Sleep })
+}
+
+func (m *MemoryStore) GetSleepStages(ctx context.Context, date string) ([]model.SleepStageSegment, error) {
+	return memoryList(m, func() []model.SleepStageSegment { return m.SleepStages })
+}
+
+// GetWorkouts filters and pages through the seeded workouts the same way the
+// SQL WHERE and LIMIT/OFFSET would
+func (m *MemoryStore) GetWorkouts(ctx context.Context, startDate, date, workoutType string, page model.Pagination) (*model.WorkoutPage, error) {
+	workouts, err := memoryList(m, func() []model.Workout { return m.Workouts })
+	if err != nil {
+		return nil, err
+	}
+	if workoutType != "" {
+		matching := workouts[:0]
+		for _, workout := range workouts {
+			if workout.Name == workoutType {
+				matching = append(matching, workout)
+			}
+		}
+		workouts = matching
+	}
+
+	total := len(workouts)
+	offset := min(page.Offset, total)
+	end := total
+	if page.Limit > 0 {
+		end = min(offset+page.Limit, total)
+	}
+
+	return &model.WorkoutPage{
+		Workouts: workouts[offset:end],
+		Total:    total,
+		Offset:   page.Offset,
+	}, nil
+}
+
+// GetWorkoutWeeklyVolume groups the seeded workouts by ISO week. Seeded
+// workouts have no stored time, so their Time must be "2006-01-02 15:04".
+func (m *MemoryStore) GetWorkoutWeeklyVolume(ctx context.Context, endDate string) ([]model.WorkoutWeek, error) {
+	workouts, err := memoryList(m, func() []model.Workout { return m.Workouts })
+	if err != nil {
+		return nil, err
+	}
+	started := make([]startedWorkout, 0, len(workouts))
+	for _, workout := range workouts {
+		start, err := time.Parse("2006-01-02 15:04", workout.Time)
+		if err != nil {
+			continue
+		}
+		started = append(started, startedWorkout{start: start, workout: workout})
+	}
+	return groupWorkoutWeeks(started), nil
+}
+
+// GetWorkoutDetail returns the detail seeded for workoutID, or model.ErrNotFound.
+// Seeded zones are returned as is.
+func (m *MemoryStore) GetWorkoutDetail(ctx context.Context, workoutID string, zones model.HRZones) (*model.WorkoutDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	detail, ok := m.WorkoutDetails[workoutID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	copied := *detail
+	copied.HeartRate = append([]model.TimeSeriesValue(nil), detail.HeartRate...)
+	copied.Zones = append([]model.HRZoneTime(nil), detail.Zones...)
+	return &copied, nil
+}
+
+// GetWorkoutTypes returns the sorted distinct names of the seeded workouts
+func (m *MemoryStore) GetWorkoutTypes(ctx context.Context) ([]string, error) {
+	workouts, err := memoryList(m, func() []model.Workout { return m.Workouts })
+	if err != nil {
+		return nil, err
+	}
+	types := []string{}
+	for _, workout := range workouts {
+		if workout.Name != "" && !slices.Contains(types, workout.Name) {
+			types = append(types, workout.Name)
+		}
+	}
+	slices.Sort(types)
+	return types, nil
+}
+
+func (m *MemoryStore) GetDietaryTrends(ctx context.Context, startDate, endDate string, window int) ([]model.DietaryTrend, error) {
+	return memoryList(m, func() []model.DietaryTrend { return m.DietaryTrends })
+}
+
+// GetDietaryTotals returns the totals seeded for date, or zero totals
+func (m *MemoryStore) GetDietaryTotals(ctx context.Context, date string) (*model.DietaryTotals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if totals, ok := m.DietaryTotals[date]; ok {
+		copied := *totals
+		return &copied, nil
+	}
+	return &model.DietaryTotals{Date: date}, nil
+}
+
+// GetMacroBreakdown computes the breakdown from the totals seeded for date
+func (m *MemoryStore) GetMacroBreakdown(ctx context.Context, date string) (*model.MacroBreakdown, error) {
+	totals, err := m.GetDietaryTotals(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	return macroBreakdown(totals), nil
+}
+
+func (m *MemoryStore) GetDietaryMealsToday(ctx context.Context, date string) ([]model.Meal, error) {
+	return memoryList(m, func() []model.Meal { return m.Meals })
+}
+
+func (m *MemoryStore) GetBodyComposition(ctx context.Context, startDate, endDate string) ([]model.BodyComposition, error) {
+	return memoryList(m, func() []model.BodyComposition { return m.BodyComposition })
+}
+
+func (m *MemoryStore) GetWeight(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.Weight })
+}
+
+func (m *MemoryStore) GetBodyFat(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	return memoryList(m, func() []model.TimeSeriesValue { return m.BodyFat })
+}
+
+// memoryList returns a copy of seeded data so callers (e.g. unit conversion in
+// the handlers) can't mutate the store. Like InfluxDBStore, nothing seeded is
+// an empty list rather than nil, so it still encodes as [].
+func memoryList[T any](m *MemoryStore, seeded func() []T) ([]T, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return append([]T{}, seeded()...), nil
+}
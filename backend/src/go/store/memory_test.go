@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"health_app/api/model"
+)
+
+func TestMemoryStoreIngestTruncatesToPrecision(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 8, 30, 15, 123456789, time.UTC)
+	tests := []struct {
+		precision model.Precision
+		want      time.Time
+	}{
+		{model.PrecisionSecond, time.Date(2024, 3, 5, 8, 30, 15, 0, time.UTC)},
+		{model.PrecisionMillisecond, time.Date(2024, 3, 5, 8, 30, 15, 123000000, time.UTC)},
+		{model.PrecisionMicrosecond, time.Date(2024, 3, 5, 8, 30, 15, 123456000, time.UTC)},
+		{model.PrecisionNanosecond, ts},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.precision), func(t *testing.T) {
+			m := NewMemoryStore()
+			metric := model.Metric{Measurement: "heart_rate", Fields: map[string]interface{}{"value": 62.0}, Timestamp: ts}
+			result, err := m.Ingest(context.Background(), []model.Metric{metric}, tt.precision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Written != 1 {
+				t.Errorf("Written = %d, want 1", result.Written)
+			}
+			if got := m.Metrics[0].Timestamp; !got.Equal(tt.want) {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreValidateIngestWritesNothing(t *testing.T) {
+	m := NewMemoryStore()
+	metric := model.Metric{Measurement: "heart_rate", Fields: map[string]interface{}{"value": 62.0}}
+	result, err := m.ValidateIngest(context.Background(), []model.Metric{metric}, model.PrecisionSecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.Written != 1 {
+		t.Errorf("got %+v, want a dry run of 1 metric", result)
+	}
+	if len(m.Metrics) != 0 {
+		t.Errorf("dry run stored %d metrics", len(m.Metrics))
+	}
+}
+
+func TestMemoryStoreErrFailsEveryMethod(t *testing.T) {
+	boom := errors.New("boom")
+	m := NewMemoryStore()
+	m.Err = boom
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"Ingest": func() error {
+			_, err := m.Ingest(ctx, nil, model.PrecisionSecond)
+			return err
+		},
+		"GetSummary": func() error {
+			_, err := m.GetSummary(ctx, "2024-03-05", "")
+			return err
+		},
+		"GetMeasurements": func() error {
+			_, err := m.GetMeasurements(ctx)
+			return err
+		},
+		"GetWorkouts": func() error {
+			_, err := m.GetWorkouts(ctx, "", "2024-03-05", "", model.Pagination{})
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, boom) {
+				t.Errorf("err = %v, want %v", err, boom)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreListsAreCopies(t *testing.T) {
+	m := NewMemoryStore()
+	m.Weight = []model.TimeSeriesValue{{Time: "2024-03-05", Value: 80}}
+
+	weight, err := m.GetWeight(context.Background(), "", "2024-03-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weight[0].Value = 176 // as a unit conversion would
+	if m.Weight[0].Value != 80 {
+		t.Errorf("caller mutated the seeded weight to %v", m.Weight[0].Value)
+	}
+
+	empty, err := m.GetBodyFat(context.Background(), "", "2024-03-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty == nil {
+		t.Error("unseeded list is nil, want empty")
+	}
+}
+
+func TestMemoryStoreGetWorkoutsPages(t *testing.T) {
+	m := NewMemoryStore()
+	m.Workouts = []model.Workout{{ID: "a", Name: "Running"}, {ID: "b", Name: "Cycling"}, {ID: "c", Name: "Running"}}
+
+	tests := []struct {
+		name        string
+		workoutType string
+		page        model.Pagination
+		wantIDs     []string
+		wantTotal   int
+	}{
+		{name: "everything", wantIDs: []string{"a", "b", "c"}, wantTotal: 3},
+		{name: "limit", page: model.Pagination{Limit: 2}, wantIDs: []string{"a", "b"}, wantTotal: 3},
+		{name: "offset", page: model.Pagination{Offset: 1}, wantIDs: []string{"b", "c"}, wantTotal: 3},
+		{name: "past the end", page: model.Pagination{Limit: 2, Offset: 5}, wantIDs: nil, wantTotal: 3},
+		{name: "type filter", workoutType: "Running", page: model.Pagination{Limit: 1}, wantIDs: []string{"a"}, wantTotal: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.GetWorkouts(context.Background(), "", "2024-03-05", tt.workoutType, tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, workout := range got.Workouts {
+				ids = append(ids, workout.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) || got.Total != tt.wantTotal || got.Offset != tt.page.Offset {
+				t.Errorf("got %v (total %d, offset %d), want %v (total %d, offset %d)", ids, got.Total, got.Offset, tt.wantIDs, tt.wantTotal, tt.page.Offset)
+			}
+		})
+	}
+}
+
+func TestMemoryStorePatchMetric(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		patch   model.Metric
+		wantErr error
+		want    float64
+	}{
+		{
+			name:  "matching point",
+			patch: model.Metric{Measurement: "weight", Tags: map[string]string{"source": "scale"}, Timestamp: ts, Fields: map[string]interface{}{"value": 79.5}},
+			want:  79.5,
+		},
+		{
+			name:    "different tags",
+			patch:   model.Metric{Measurement: "weight", Tags: map[string]string{"source": "phone"}, Timestamp: ts, Fields: map[string]interface{}{"value": 79.5}},
+			wantErr: model.ErrNotFound,
+			want:    80,
+		},
+		{
+			name:    "different time",
+			patch:   model.Metric{Measurement: "weight", Tags: map[string]string{"source": "scale"}, Timestamp: ts.Add(time.Second), Fields: map[string]interface{}{"value": 79.5}},
+			wantErr: model.ErrNotFound,
+			want:    80,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryStore()
+			m.Metrics = []model.Metric{{Measurement: "weight", Tags: map[string]string{"source": "scale"}, Timestamp: ts, Fields: map[string]interface{}{"value": 80.0}}}
+
+			result, err := m.PatchMetric(context.Background(), tt.patch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := m.Metrics[0].Fields["value"]; got != tt.want {
+				t.Errorf("stored value = %v, want %v", got, tt.want)
+			}
+			if err == nil && (len(result.Changes) != 1 || result.Changes[0].Old != 80.0) {
+				t.Errorf("changes = %+v, want value 80 -> %v", result.Changes, tt.want)
+			}
+		})
+	}
+}
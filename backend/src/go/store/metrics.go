@@ -0,0 +1,28 @@
+package store
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// queryDuration records how long queries against each measurement take, so
+// slow tables show up in the latency distribution
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "influxdb_query_duration_seconds",
+	Help:    "InfluxDB query latency by measurement.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"measurement"})
+
+var fromMeasurement = regexp.MustCompile(`(?i)\bFROM\s+"?([\w.]+)"?`)
+
+// observeQuery records the duration of sqlQuery under the first measurement it reads from
+func observeQuery(sqlQuery string, start time.Time) {
+	measurement := "unknown"
+	if match := fromMeasurement.FindStringSubmatch(sqlQuery); match != nil {
+		measurement = match[1]
+	}
+	queryDuration.WithLabelValues(measurement).Observe(time.Since(start).Seconds())
+}
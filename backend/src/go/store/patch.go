@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"health_app/api/model"
+
+	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
+)
+
+// PatchMetric overwrites fields of the one point with m's measurement, exact
+// tag set and timestamp, and returns model.ErrNotFound if there's no such
+// point. The point is rewritten whole with the patched fields merged in, so
+// the write replaces it rather than creating a new series.
+func (s *InfluxDBStore) PatchMetric(ctx context.Context, m model.Metric) (*model.PatchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tagKeys, err := s.tagKeys(ctx, m.Measurement)
+	if err != nil {
+		return nil, err
+	}
+	// A tag the measurement has never had can't match a point
+	for key := range m.Tags {
+		if !slices.Contains(tagKeys, key) {
+			return nil, model.ErrNotFound
+		}
+	}
+
+	// Tags missing from the request must be unset on the point, or the
+	// rewrite would land in a different series
+	conditions := []string{"time = $time"}
+	params := influxdb3.QueryParameters{"time": m.Timestamp.UTC().Format(time.RFC3339Nano)}
+	for i, key := range tagKeys {
+		value, ok := m.Tags[key]
+		if !ok {
+			conditions = append(conditions, fmt.Sprintf(`"%s" IS NULL`, key))
+			continue
+		}
+		param := fmt.Sprintf("tag%d", i)
+		conditions = append(conditions, fmt.Sprintf(`"%s" = $%s`, key, param))
+		params[param] = value
+	}
+	sqlQuery := fmt.Sprintf(`
+SELECT *
+FROM "%s"
+WHERE %s`, m.Measurement, strings.Join(conditions, " AND "))
+
+	result, err := s.query(ctx, sqlQuery, params)
+	if err != nil {
+		return nil, err
+	}
+	var existing map[string]interface{}
+	for result.Next() {
+		existing = result.Value()
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	if existing == nil {
+		return nil, model.ErrNotFound
+	}
+
+	point := model.Metric{
+		Measurement: m.Measurement,
+		Tags:        m.Tags,
+		Fields:      make(map[string]interface{}),
+		FieldTypes:  make(map[string]model.FieldType),
+		Timestamp:   m.Timestamp,
+	}
+	for column, value := range existing {
+		if column != "time" && value != nil && !slices.Contains(tagKeys, column) {
+			point.Fields[column] = value
+		}
+	}
+	patch := &model.PatchResult{Measurement: m.Measurement, Tags: m.Tags, Timestamp: m.Timestamp}
+	for _, field := range slices.Sorted(maps.Keys(m.Fields)) {
+		if slices.Contains(tagKeys, field) {
+			return nil, fmt.Errorf("%w: %q is a tag, not a field", model.ErrInvalidPatch, field)
+		}
+		old := point.Fields[field]
+		// Keep an integer column integer when the JSON number decodes as float64
+		if _, isInt := old.(int64); isInt && m.FieldTypes[field] == "" {
+			point.FieldTypes[field] = model.FieldTypeInteger
+		} else if fieldType, ok := m.FieldTypes[field]; ok {
+			point.FieldTypes[field] = fieldType
+		}
+		point.Fields[field] = m.Fields[field]
+		patch.Changes = append(patch.Changes, model.FieldChange{Field: field, Old: old, New: m.Fields[field]})
+	}
+
+	p, errs := metricToPoint(point)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %v", model.ErrInvalidPatch, errs[0])
+	}
+	err = s.writeWithRetry(ctx, func(client *influxdb3.Client) error {
+		return client.WritePoints(ctx, []*influxdb3.Point{p})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// tagKeys returns the tag columns of measurement, or model.ErrNotFound if it
+// has never been written. InfluxDB 3 stores tags as dictionary-encoded strings.
+func (s *InfluxDBStore) tagKeys(ctx context.Context, measurement string) ([]string, error) {
+	sqlQuery := `
+SELECT column_name, data_type
+FROM information_schema.columns
+WHERE table_schema = 'iox' AND table_name = $measurement`
+
+	result, err := s.query(ctx, sqlQuery, influxdb3.QueryParameters{"measurement": measurement})
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	var keys []string
+	for result.Next() {
+		found = true
+		record := result.Value()
+		column, _ := record["column_name"].(string)
+		dataType, _ := record["data_type"].(string)
+		if strings.HasPrefix(dataType, "Dictionary") {
+			keys = append(keys, column)
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	if !found {
+		return nil, model.ErrNotFound
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restingHRConfig is how a day's resting heart rate is computed when no
+// resting_heart_rate reading was synced: the lowest rolling average over
+// Rolling during the local hours StartHour to EndHour. A StartHour after
+// EndHour starts on the previous evening.
+type restingHRConfig struct {
+	Rolling   time.Duration
+	StartHour int
+	EndHour   int
+}
+
+// loadRestingHRConfig reads RESTING_HR_ROLLING_MINUTES (default 5) and
+// RESTING_HR_SLEEP_HOURS ("start-end" local hours, default "0-6")
+func loadRestingHRConfig() restingHRConfig {
+	cfg := restingHRConfig{Rolling: 5 * time.Minute, StartHour: 0, EndHour: 6}
+
+	if value := os.Getenv("RESTING_HR_ROLLING_MINUTES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			slog.Warn("invalid environment variable",
+				slog.String("name", "RESTING_HR_ROLLING_MINUTES"), slog.String("value", value), slog.Duration("using", cfg.Rolling))
+		} else {
+			cfg.Rolling = time.Duration(n) * time.Minute
+		}
+	}
+
+	if value := os.Getenv("RESTING_HR_SLEEP_HOURS"); value != "" {
+		low, high, ok := strings.Cut(value, "-")
+		startHour, errStart := strconv.Atoi(low)
+		endHour, errEnd := strconv.Atoi(high)
+		if !ok || errStart != nil || errEnd != nil || startHour < 0 || startHour > 23 || endHour < 0 || endHour > 23 || startHour == endHour {
+			slog.Warn("invalid environment variable, expected start-end hours",
+				slog.String("name", "RESTING_HR_SLEEP_HOURS"), slog.String("value", value),
+				slog.String("using", fmt.Sprintf("%d-%d", cfg.StartHour, cfg.EndHour)))
+		} else {
+			cfg.StartHour, cfg.EndHour = startHour, endHour
+		}
+	}
+	return cfg
+}
+
+// sleepWindowUTC returns the configured sleep window for the night ending on
+// dateStr, as RFC3339 UTC bounds
+func (cfg restingHRConfig) sleepWindowUTC(dateStr string, loc *time.Location) (string, string) {
+	t, _ := time.ParseInLocation("2006-01-02", dateStr, loc)
+	stopLocal := time.Date(t.Year(), t.Month(), t.Day(), cfg.EndHour, 0, 0, 0, loc)
+	startLocal := time.Date(t.Year(), t.Month(), t.Day(), cfg.StartHour, 0, 0, 0, loc)
+	if cfg.StartHour > cfg.EndHour {
+		startLocal = startLocal.AddDate(0, 0, -1)
+	}
+	return startLocal.UTC().Format(time.RFC3339), stopLocal.UTC().Format(time.RFC3339)
+}
+
+// GetRestingHRForDay returns the day's resting heart rate: the latest synced
+// resting_heart_rate reading if there is one, otherwise the lowest rolling
+// average of heart_rate during the configured sleep window. It returns 0 when
+// there's no data for either.
+func (s *InfluxDBStore) GetRestingHRForDay(ctx context.Context, date string) (float64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	start, stop := getDayRangeUTC(date, s.loc)
+	sqlQuery := `
+SELECT qty AS value
+FROM "resting_heart_rate"
+WHERE time >= $start AND time < $stop
+ORDER BY time DESC
+LIMIT 1`
+
+	// Only some sources sync resting_heart_rate, so a missing table just means
+	// computing it instead
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err == nil {
+		for result.Next() {
+			if value, ok := result.Value()["value"].(float64); ok {
+				return value, nil
+			}
+		}
+		if result.Err() != nil {
+			return 0, result.Err()
+		}
+	}
+
+	start, stop = s.restingHR.sleepWindowUTC(date, s.loc)
+	sqlQuery = `
+SELECT time, "avg" AS value
+FROM "heart_rate"
+WHERE time >= $start AND time < $stop
+ORDER BY time ASC`
+
+	result, err = s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return 0, err
+	}
+	var times []time.Time
+	var values []float64
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		value, okVal := record["value"].(float64)
+		if okTime && okVal {
+			times = append(times, t)
+			values = append(values, value)
+		}
+	}
+	if result.Err() != nil {
+		return 0, result.Err()
+	}
+	return lowestRollingAverage(times, values, s.restingHR.Rolling), nil
+}
+
+// lowestRollingAverage returns the lowest mean of the readings in any window
+// of width ending on a reading. Windows that start before the first reading
+// aren't full, so they're skipped; if no window is full, the mean of every
+// reading is used.
+func lowestRollingAverage(times []time.Time, values []float64, width time.Duration) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	lowest, found := 0.0, false
+	sum, first := 0.0, 0
+	for i, t := range times {
+		sum += values[i]
+		for times[first].Before(t.Add(-width)) {
+			sum -= values[first]
+			first++
+		}
+		if t.Sub(times[0]) < width {
+			continue
+		}
+		if avg := sum / float64(i-first+1); !found || avg < lowest {
+			lowest, found = avg, true
+		}
+	}
+	if !found {
+		return sum / float64(len(values))
+	}
+	return lowest
+}
@@ -2,23 +2,128 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"health_app/api/model"
 
 	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-var easternZone, _ = time.LoadLocation("America/New_York")
+const (
+	defaultTimezone     = "America/New_York"
+	defaultQueryTimeout = 30 * time.Second
+	defaultWriteRetries = 3
+	writeRetryBaseDelay = 200 * time.Millisecond
+	defaultQueryRetries = 0
+	queryRetryBaseDelay = 200 * time.Millisecond
+)
 
 type InfluxDBStore struct {
-	client *influxdb3.Client
-	bucket string
-	org    string
+	// client is created on first use so the server can start before InfluxDB
+	// is reachable; guarded by mu, as is draining
+	mu           sync.Mutex
+	client       *influxdb3.Client
+	draining     bool
+	writes       sync.WaitGroup // Outstanding writes, waited on by Drain
+	writesActive atomic.Int64
+	httpClient   *http.Client
+	host         string
+	token        string
+	bucket       string
+	org          string
+	loc          *time.Location
+	queryTimeout time.Duration
+	queryRetries int // Extra attempts after a transient query failure
+	writeRetries int
+	stepGoal     int
+	calorieGoal  float64 // Active calories
+	windows      windowConfig
+	restingHR    restingHRConfig
+
+	// userTablesCache holds the tables with a user_id column, refreshed after
+	// userTablesTTL or any write; guarded by userTablesMu
+	userTablesMu    sync.Mutex
+	userTablesCache map[string]bool
+	userTablesAt    time.Time
+}
+
+// windowConfig holds how many days each range endpoint covers when the caller
+// gives no start_date. Each is overridable via its <NAME>_WINDOW_DAYS env var.
+type windowConfig struct {
+	HRDaily         int
+	BloodPressure   int
+	Glucose         int
+	Spo2            int
+	HRV             int
+	RespiratoryRate int
+	VO2Max          int
+	RestingHR       int
+	Sleep           int
+	SleepWeekly     int // Wider defaults so aggregates have more than one bucket
+	SleepMonthly    int
+	Workouts        int
+	DietaryTrends   int
+	BodyComposition int
+	Weight          int
+	BodyFat         int
+	BodyTemperature int
+	Distance        int
+}
+
+func loadWindows() windowConfig {
+	return windowConfig{
+		HRDaily:         loadWindowDays("HR_DAILY_WINDOW_DAYS", 30),
+		BloodPressure:   loadWindowDays("BP_WINDOW_DAYS", 30),
+		Glucose:         loadWindowDays("GLUCOSE_WINDOW_DAYS", 30),
+		Spo2:            loadWindowDays("SPO2_WINDOW_DAYS", 30),
+		HRV:             loadWindowDays("HRV_WINDOW_DAYS", 30),
+		RespiratoryRate: loadWindowDays("RESPIRATORY_WINDOW_DAYS", 30),
+		VO2Max:          loadWindowDays("VO2MAX_WINDOW_DAYS", 90),
+		RestingHR:       loadWindowDays("RESTING_HR_WINDOW_DAYS", 90),
+		Sleep:           loadWindowDays("SLEEP_WINDOW_DAYS", 7),
+		SleepWeekly:     loadWindowDays("SLEEP_WEEKLY_WINDOW_DAYS", 12*7),
+		SleepMonthly:    loadWindowDays("SLEEP_MONTHLY_WINDOW_DAYS", 365),
+		Workouts:        loadWindowDays("WORKOUTS_WINDOW_DAYS", 90),
+		DietaryTrends:   loadWindowDays("DIETARY_WINDOW_DAYS", 30),
+		BodyComposition: loadWindowDays("BODY_COMPOSITION_WINDOW_DAYS", 30),
+		Weight:          loadWindowDays("WEIGHT_WINDOW_DAYS", 30),
+		BodyFat:         loadWindowDays("BODY_FAT_WINDOW_DAYS", 30),
+		BodyTemperature: loadWindowDays("BODY_TEMPERATURE_WINDOW_DAYS", 30),
+		Distance:        loadWindowDays("DISTANCE_WINDOW_DAYS", 30),
+	}
+}
+
+// loadWindowDays reads a positive day count from name, falling back to def
+func loadWindowDays(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", name), slog.String("value", value), slog.Int("using", def))
+		return def
+	}
+	return n
 }
 
 func NewInfluxDBStore() (*InfluxDBStore, error) {
@@ -34,34 +139,193 @@ func NewInfluxDBStore() (*InfluxDBStore, error) {
 		if err != nil {
 			return nil, fmt.Errorf("INFLUX_HOST, INFLUX_TOKEN, INFLUX_ORG, and INFLUX_DATABASE must be set")
 		}
-		url = "http://10.0.0.9:8181"
+		url = os.Getenv("INFLUX_HOST")
 		token = os.Getenv("INFLUX_TOKEN")
 		org = os.Getenv("INFLUX_ORG")
 		bucket = os.Getenv("INFLUX_DATABASE")
 	}
 
+	var missing []string
+	for name, value := range map[string]string{
+		"INFLUX_HOST":     url,
+		"INFLUX_TOKEN":    token,
+		"INFLUX_ORG":      org,
+		"INFLUX_DATABASE": bucket,
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	loc := loadLocation()
+	queryTimeout := loadQueryTimeout()
+	queryRetries := loadQueryRetries()
+	writeRetries := loadWriteRetries()
+
 	// For Debug
-	log.Printf("Connecting to InfluxDB at: %s (org: %s, bucket: %s)", url, org, bucket)
+	log.Printf("Using InfluxDB at: %s (org: %s, bucket: %s)", url, org, bucket)
+
+	return &InfluxDBStore{
+		httpClient:   &http.Client{},
+		host:         strings.TrimSuffix(url, "/"),
+		token:        token,
+		bucket:       bucket,
+		org:          org,
+		loc:          loc,
+		queryTimeout: queryTimeout,
+		queryRetries: queryRetries,
+		writeRetries: writeRetries,
+		stepGoal:     int(loadGoal("STEP_GOAL")),
+		calorieGoal:  loadGoal("CALORIE_GOAL"),
+		windows:      loadWindows(),
+		restingHR:    loadRestingHRConfig(),
+	}, nil
+}
+
+// getClient returns the InfluxDB client, creating it if an earlier attempt
+// hasn't succeeded yet
+func (s *InfluxDBStore) getClient() (*influxdb3.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
 
 	client, err := influxdb3.New(influxdb3.ClientConfig{
-		Host:         url,
-		Token:        token,
-		Database:     bucket,
-		Organization: org,
+		Host:         s.host,
+		Token:        s.token,
+		Database:     s.bucket,
+		Organization: s.org,
 	})
-
 	if err != nil {
 		return nil, fmt.Errorf("failed to create InfluxDB client: %w", err)
 	}
+	log.Printf("Connected to InfluxDB at: %s", s.host)
+	s.client = client
+	return client, nil
+}
+
+// Ping checks that InfluxDB is reachable and accepts our token
+func (s *InfluxDBStore) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if _, err := s.getClient(); err != nil {
+		return err
+	}
 
-	return &InfluxDBStore{
-		client: client,
-		bucket: bucket,
-		org:    org,
-	}, nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.host+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+s.token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("InfluxDB unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("InfluxDB ping failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// loadWriteRetries reads INFLUX_WRITE_RETRIES, the total number of write attempts
+func loadWriteRetries() int {
+	value := os.Getenv("INFLUX_WRITE_RETRIES")
+	if value == "" {
+		return defaultWriteRetries
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INFLUX_WRITE_RETRIES"), slog.String("value", value), slog.Int("using", defaultWriteRetries))
+		return defaultWriteRetries
+	}
+	return n
+}
+
+// loadQueryTimeout reads INFLUX_QUERY_TIMEOUT (e.g. 10s), falling back to the default
+func loadQueryTimeout() time.Duration {
+	value := os.Getenv("INFLUX_QUERY_TIMEOUT")
+	if value == "" {
+		return defaultQueryTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INFLUX_QUERY_TIMEOUT"), slog.String("value", value), slog.Duration("using", defaultQueryTimeout))
+		return defaultQueryTimeout
+	}
+	return timeout
+}
+
+// loadQueryRetries reads INFLUX_QUERY_RETRIES, the number of retries after a
+// transient query failure; zero disables retrying
+func loadQueryRetries() int {
+	value := os.Getenv("INFLUX_QUERY_RETRIES")
+	if value == "" {
+		return defaultQueryRetries
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		slog.Warn("invalid environment variable",
+			slog.String("name", "INFLUX_QUERY_RETRIES"), slog.String("value", value), slog.Int("using", defaultQueryRetries))
+		return defaultQueryRetries
+	}
+	return n
+}
+
+// loadGoal reads an optional daily goal from name; zero means no goal
+func loadGoal(name string) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	goal, err := strconv.ParseFloat(value, 64)
+	if err != nil || goal <= 0 {
+		slog.Warn("invalid environment variable, ignoring goal",
+			slog.String("name", name), slog.String("value", value))
+		return 0
+	}
+	return goal
+}
+
+// loadLocation resolves the display timezone from APP_TIMEZONE (or TZ),
+// falling back to Eastern time when unset or invalid
+func loadLocation() *time.Location {
+	name := os.Getenv("APP_TIMEZONE")
+	if name == "" {
+		name = os.Getenv("TZ")
+	}
+	if name != "" {
+		loc, err := time.LoadLocation(name)
+		if err == nil {
+			log.Printf("Using timezone: %s", loc)
+			return loc
+		}
+		slog.Warn("invalid APP_TIMEZONE",
+			slog.String("value", name), slog.String("using", defaultTimezone), slog.Any("error", err))
+	} else {
+		slog.Warn("APP_TIMEZONE not set", slog.String("using", defaultTimezone))
+	}
+
+	loc, err := time.LoadLocation(defaultTimezone)
+	if err != nil {
+		slog.Warn("could not load the default timezone, using UTC",
+			slog.String("timezone", defaultTimezone), slog.Any("error", err))
+		return time.UTC
+	}
+	return loc
 }
 
 func (s *InfluxDBStore) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.client != nil {
 		log.Println("Closing InfluxDB client...")
 		s.client.Close()
@@ -69,77 +333,335 @@ func (s *InfluxDBStore) Close() {
 	}
 }
 
-func (s *InfluxDBStore) Ingest(metrics []model.Metric) error {
-	// Convert metrics to line protocol format
-	var lineProtocol string
-	for _, m := range metrics {
-		// Build tags string
-		tagStr := ""
-		for k, v := range m.Tags {
-			if tagStr != "" {
-				tagStr += ","
-			}
-			tagStr += fmt.Sprintf("%s=%s", k, v)
+// ErrShuttingDown is returned for writes started after Drain
+var ErrShuttingDown = errors.New("store is shutting down")
+
+// beginWrite registers an outstanding write and returns the func that ends
+// it. New writes are refused once Drain has started.
+func (s *InfluxDBStore) beginWrite() (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return nil, ErrShuttingDown
+	}
+	s.writes.Add(1)
+	s.writesActive.Add(1)
+	return func() {
+		s.writesActive.Add(-1)
+		s.writes.Done()
+	}, nil
+}
+
+// Drain refuses new writes and waits for outstanding ones to finish or ctx to
+// expire, returning how many finished and how many were still running. Call
+// it before Close so in-flight batches aren't cut off.
+func (s *InfluxDBStore) Drain(ctx context.Context) (drained, abandoned int) {
+	s.mu.Lock()
+	s.draining = true
+	pending := int(s.writesActive.Load())
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	abandoned = int(s.writesActive.Load())
+	return pending - abandoned, abandoned
+}
+
+// Ingest writes metrics as points through the client's point API, which
+// handles line protocol escaping and field typing. Fields of unsupported types
+// (e.g. nested objects) are dropped, and a metric left with no fields, or one
+// that can't be encoded, is skipped; both are reported in the result rather
+// than failing the batch.
+func (s *InfluxDBStore) Ingest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	lpPrecision := lineProtocolPrecision(precision)
+	points, result := buildPoints(metrics, lpPrecision)
+	if result.Written == 0 {
+		return result, nil
+	}
+	err := s.writeWithRetry(ctx, func(client *influxdb3.Client) error {
+		return client.WritePoints(ctx, points, influxdb3.WithPrecision(lpPrecision))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ValidateIngest builds and encodes points exactly as Ingest does but never
+// writes them, reporting what Ingest would have written
+func (s *InfluxDBStore) ValidateIngest(ctx context.Context, metrics []model.Metric, precision model.Precision) (*model.IngestResult, error) {
+	_, result := buildPoints(metrics, lineProtocolPrecision(precision))
+	result.DryRun = true
+	return result, nil
+}
+
+// buildPoints converts metrics to encodable points, counting the rest as
+// skipped with their errors
+func buildPoints(metrics []model.Metric, lpPrecision lineprotocol.Precision) ([]*influxdb3.Point, *model.IngestResult) {
+	result := &model.IngestResult{}
+	var points []*influxdb3.Point
+	for i, m := range metrics {
+		point, errs := metricToPoint(m)
+		for _, err := range errs {
+			result.Errors = append(result.Errors, fmt.Sprintf("metric %d: %v", i, err))
+		}
+		if !point.HasFields() {
+			result.Skipped++
+			continue
+		}
+		// Encode up front so one bad point (e.g. a NaN field) is skipped
+		// instead of failing the whole write
+		if _, err := point.MarshalBinary(lpPrecision); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("metric %d: %v", i, err))
+			result.Skipped++
+			continue
 		}
+		points = append(points, point)
+	}
+	result.Written = len(points)
+	return points, result
+}
 
-		// Build fields string
-		fieldStr := ""
-		for k, v := range m.Fields {
-			if fieldStr != "" {
-				fieldStr += ","
-			}
-			switch val := v.(type) {
-			case string:
-				fieldStr += fmt.Sprintf(`%s="%s"`, k, val)
-			case float64:
-				fieldStr += fmt.Sprintf("%s=%f", k, val)
-			case int64:
-				fieldStr += fmt.Sprintf("%s=%di", k, val)
-			case int:
-				fieldStr += fmt.Sprintf("%s=%di", k, val)
-			case bool:
-				fieldStr += fmt.Sprintf("%s=%t", k, val)
-			default:
-				fieldStr += fmt.Sprintf("%s=%v", k, val)
+// metricToPoint converts a metric to a point, returning an error for each
+// field of an unsupported type. A metric without a timestamp is left unstamped
+// so the server uses its arrival time.
+func metricToPoint(m model.Metric) (*influxdb3.Point, []error) {
+	point := influxdb3.NewPointWithMeasurement(m.Measurement)
+	for k, v := range m.Tags {
+		point.SetTag(k, v)
+	}
+
+	var errs []error
+	for k, v := range m.Fields {
+		switch val := v.(type) {
+		case string:
+			point.SetStringField(k, val)
+		case float64:
+			if m.FieldTypes[k] == model.FieldTypeInteger {
+				point.SetIntegerField(k, int64(val))
+			} else {
+				point.SetDoubleField(k, val)
 			}
+		case int64:
+			point.SetIntegerField(k, val)
+		case int:
+			point.SetIntegerField(k, int64(val))
+		case bool:
+			point.SetBooleanField(k, val)
+		default:
+			errs = append(errs, fmt.Errorf("field %q has unsupported type %T", k, v))
+		}
+	}
+
+	if !m.Timestamp.IsZero() {
+		point.SetTimestamp(m.Timestamp)
+	}
+	return point, errs
+}
+
+// lineProtocolPrecision maps a model precision to the client's; timestamps are
+// truncated to it when points are encoded
+func lineProtocolPrecision(precision model.Precision) lineprotocol.Precision {
+	switch precision {
+	case model.PrecisionSecond:
+		return lineprotocol.Second
+	case model.PrecisionMillisecond:
+		return lineprotocol.Millisecond
+	case model.PrecisionMicrosecond:
+		return lineprotocol.Microsecond
+	default:
+		return lineprotocol.Nanosecond
+	}
+}
+
+// writeWithRetry runs write, retrying transient failures with exponential
+// backoff. Permanent errors such as rejected line protocol are returned
+// immediately.
+func (s *InfluxDBStore) writeWithRetry(ctx context.Context, write func(client *influxdb3.Client) error) error {
+	end, err := s.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+	err = retryWrite(ctx, s.writeRetries, writeRetryBaseDelay, func() error {
+		return write(client)
+	})
+	if err == nil {
+		s.forgetUserTables()
+	}
+	return err
+}
+
+// retryWrite makes up to attempts calls to write, backing off exponentially
+// from baseDelay (or as long as the server's Retry-After asks) between
+// transient failures
+func retryWrite(ctx context.Context, attempts int, baseDelay time.Duration, write func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = write()
+		if err == nil || !isTransientWriteError(err) || attempt == attempts {
+			return err
+		}
+
+		delay := baseDelay << (attempt - 1)
+		var serverErr *influxdb3.ServerError
+		if errors.As(err, &serverErr) && serverErr.RetryAfter > 0 {
+			delay = time.Duration(serverErr.RetryAfter) * time.Second
+		}
+		slog.WarnContext(ctx, "influxdb write failed, retrying",
+			slog.Int("attempt", attempt), slog.Int("attempts", attempts),
+			slog.Duration("delay", delay), slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// isTransientWriteError reports whether a write failure is worth retrying:
+// network errors, throttling and server-side 5xx responses
+func isTransientWriteError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var serverErr *influxdb3.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode == http.StatusTooManyRequests || serverErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// withTimeout bounds a store call by the configured query timeout, on top of
+// any deadline or cancellation already carried by the request context
+func (s *InfluxDBStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// rangeParams builds the $start/$stop query parameters for a time range
+func rangeParams(start, stop string) influxdb3.QueryParameters {
+	return influxdb3.QueryParameters{
+		"start": start,
+		"stop":  stop,
+	}
+}
+
+// query runs a parameterized SQL query; values are bound via $name placeholders
+// rather than interpolated into the query string. Queries made on behalf of a
+// user only see that user's points.
+func (s *InfluxDBStore) query(ctx context.Context, query string, params influxdb3.QueryParameters) (*influxdb3.QueryIterator, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+	defer observeQuery(query, time.Now())
+
+	sqlQuery := query
+	if userID := model.UserIDFromContext(ctx); userID != "" {
+		tables, err := s.userTables(ctx)
+		if err != nil {
+			return nil, err
 		}
+		sqlQuery = scopeToUser(query, tables)
+		scoped := influxdb3.QueryParameters{"user_id": userID}
+		for k, v := range params {
+			scoped[k] = v
+		}
+		params = scoped
+	}
 
-		// Build line protocol: measurement[,tag=value...] field=value[,field=value...] [timestamp]
-		line := m.Measurement
-		if tagStr != "" {
-			line += "," + tagStr
+	for attempt := 0; ; attempt++ {
+		result, err := client.QueryWithParameters(ctx, sqlQuery, params)
+		if err == nil || attempt >= s.queryRetries || !isTransientQueryError(err) {
+			return result, err
 		}
-		line += " " + fieldStr
-		if !m.Timestamp.IsZero() {
-			line += fmt.Sprintf(" %d", m.Timestamp.UnixNano())
+
+		delay := queryRetryBaseDelay << attempt
+		slog.WarnContext(ctx, "influxdb query failed, retrying",
+			slog.Int("attempt", attempt+1), slog.Int("attempts", s.queryRetries+1),
+			slog.Duration("delay", delay), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
 		}
-		lineProtocol += line + "\n"
 	}
+}
 
-	return s.client.Write(context.Background(), []byte(lineProtocol))
+// isTransientQueryError reports whether a query failure is worth retrying.
+// Queries go over Arrow Flight, so failures are gRPC statuses: Unavailable
+// (server restarting or unreachable), ResourceExhausted (throttled) and
+// Aborted are retried, as are raw network errors. Everything else, including
+// SQL errors (InvalidArgument) and the caller's own deadline or cancellation,
+// fails immediately.
+func isTransientQueryError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
-func (s *InfluxDBStore) query(ctx context.Context, query string) (*influxdb3.QueryIterator, error) {
-	return s.client.Query(ctx, query)
+// quotedMeasurement matches a FROM clause naming a measurement. Store queries
+// always quote measurement names, which keeps information_schema lookups out.
+var quotedMeasurement = regexp.MustCompile(`\bFROM\s+"([^"]+)"`)
+
+// scopeToUser replaces each measurement in query with a subquery over just the
+// rows tagged with $user_id, so every WHERE, GROUP BY and UNION in the original
+// query applies to that user's data alone. Measurements missing from
+// userTables have no user_id column (they predate authenticated ingest), so
+// they read as empty rather than failing the query.
+func scopeToUser(query string, userTables map[string]bool) string {
+	return quotedMeasurement.ReplaceAllStringFunc(query, func(match string) string {
+		name := quotedMeasurement.FindStringSubmatch(match)[1]
+		if !userTables[name] {
+			return fmt.Sprintf(`FROM (SELECT * FROM "%s" WHERE false) AS "%s"`, name, name)
+		}
+		return fmt.Sprintf(`FROM (SELECT * FROM "%s" WHERE %s = $user_id) AS "%s"`, name, model.UserIDTag, name)
+	})
 }
 
-func (s *InfluxDBStore) GetSummary(date string) (*model.Summary, error) {
-	start, stop := getDayRangeUTC(date)
+func (s *InfluxDBStore) GetSummary(ctx context.Context, date, source string) (*model.Summary, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	start, stop := getDayRangeUTC(date, s.loc)
 	summary := &model.Summary{}
 
-	query := fmt.Sprintf(`
+	query := `
         SELECT metric, source, value
         FROM "daily_totals"
-        WHERE time >= '%s' AND time < '%s'
-    `, start, stop)
+        WHERE time >= $start AND time < $stop
+    `
 
-	query2 := fmt.Sprintf(`
+	query2 := `
         SELECT qty
         FROM "dietary_energy"
-        WHERE time >= '%s' AND time < '%s'
-    `, start, stop)
+        WHERE time >= $start AND time < $stop
+    `
 
-	result, err := s.query(context.Background(), query)
+	result, err := s.query(ctx, query, rangeParams(start, stop))
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +669,7 @@ func (s *InfluxDBStore) GetSummary(date string) (*model.Summary, error) {
 	for result.Next() {
 		record := result.Value()
 		metric, okMetric := record["metric"].(string)
-		source, _ := record["source"].(string)
+		recordSource, _ := record["source"].(string)
 		value := record["value"]
 
 		if !okMetric || value == nil {
@@ -166,17 +688,17 @@ func (s *InfluxDBStore) GetSummary(date string) (*model.Summary, error) {
 
 		switch metric {
 		case "step_count":
-			if source == "RingConn" {
+			if recordSource == source {
 				summary.Steps = int(floatValue)
 			}
 		case "walking_running_distance":
 			summary.Distance = floatValue
 		case "active_energy":
-			if source == "RingConn" {
+			if recordSource == source {
 				summary.ActiveCalories = floatValue
 			}
 		case "basal_energy_burned":
-			if source == "RingConn" {
+			if recordSource == source {
 				summary.BasalCalories = floatValue
 			}
 		}
@@ -186,7 +708,7 @@ func (s *InfluxDBStore) GetSummary(date string) (*model.Summary, error) {
 		return nil, result.Err()
 	}
 
-	result2, err := s.query(context.Background(), query2)
+	result2, err := s.query(ctx, query2, rangeParams(start, stop))
 	if err != nil {
 		return nil, err
 	}
@@ -217,282 +739,1624 @@ func (s *InfluxDBStore) GetSummary(date string) (*model.Summary, error) {
 		return nil, result2.Err()
 	}
 
+	// Days without dietary entries count as zero intake
+	summary.NetCalories = summary.DietaryCalories - (summary.ActiveCalories + summary.BasalCalories)
+
+	// A missing heart rate shouldn't fail the rest of the summary
+	restingHR, err := s.GetRestingHRForDay(ctx, date)
+	if err != nil {
+		slog.WarnContext(ctx, "resting heart rate unavailable", slog.String("date", date), slog.Any("error", err))
+	}
+	summary.RestingHR = math.Round(restingHR*10) / 10
+
+	if s.stepGoal > 0 {
+		summary.StepGoal = s.stepGoal
+		summary.StepsProgress = goalProgress(float64(summary.Steps), float64(s.stepGoal))
+	}
+	if s.calorieGoal > 0 {
+		summary.CalorieGoal = s.calorieGoal
+		summary.CaloriesProgress = goalProgress(summary.ActiveCalories, s.calorieGoal)
+	}
+
 	return summary, nil
 }
 
-func (s *InfluxDBStore) GetVitalsHR(date string) ([]model.TimeSeriesValue, error) {
-	// Match Python behavior: use rolling 24-hour window from now
-	now := time.Now().UTC()
-	stop := now.Format(time.RFC3339)
-	start := now.Add(-24 * time.Hour).Format(time.RFC3339)
-
-	sqlQuery := fmt.Sprintf(`
-SELECT time, "avg" as value
-FROM "heart_rate"
-WHERE time > '%s' AND time <= '%s'
-ORDER BY time`, start, stop)
+// goalProgress returns value as a percentage of goal, to one decimal place
+func goalProgress(value, goal float64) *float64 {
+	progress := math.Round(value/goal*1000) / 10
+	return &progress
+}
 
-	result, err := s.query(context.Background(), sqlQuery)
+// GetSources lists the distinct data sources that have reported daily totals
+func (s *InfluxDBStore) GetSources(ctx context.Context) ([]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	sqlQuery := `
+SELECT DISTINCT source
+FROM "daily_totals"
+WHERE source IS NOT NULL
+ORDER BY source ASC`
+
+	result, err := s.query(ctx, sqlQuery, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var values []model.TimeSeriesValue
+	sources := []string{}
 	for result.Next() {
-		record := result.Value()
-		val, okVal := record["value"].(float64)
-		t, okTime := record["time"].(time.Time)
-		if okVal && okTime {
-			values = append(values, model.TimeSeriesValue{
-				Time:  t.UTC().Format("2006-01-02T15:04:05Z"),
-				Value: val,
-			})
+		if source, ok := result.Value()["source"].(string); ok && source != "" {
+			sources = append(sources, source)
 		}
 	}
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 
-	// Aggregate into 10-minute buckets
-	buckets := make(map[time.Time][]float64)
-	for _, v := range values {
-		t, _ := time.Parse("2006-01-02T15:04:05Z", v.Time)
-		bucketTime := t.Truncate(10 * time.Minute)
-		buckets[bucketTime] = append(buckets[bucketTime], v.Value)
+	return sources, nil
+}
+
+// GetMeasurements lists the measurements (tables) present in the database. For
+// an authenticated user only the measurements holding their points are listed.
+func (s *InfluxDBStore) GetMeasurements(ctx context.Context) ([]string, error) {
+	// information_schema isn't rewritten by scopeToUser, so it would list
+	// every user's tables
+	if model.UserIDFromContext(ctx) != "" {
+		return s.userMeasurements(ctx)
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	// InfluxDB 3 keeps user measurements in the "iox" schema; the rest are system tables
+	sqlQuery := `
+SELECT table_name
+FROM information_schema.tables
+WHERE table_schema = 'iox'
+ORDER BY table_name ASC`
+
+	result, err := s.query(ctx, sqlQuery, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	var aggregatedValues []model.TimeSeriesValue
-	for t, vals := range buckets {
-		var sum float64
-		for _, v := range vals {
-			sum += v
+	measurements := []string{}
+	for result.Next() {
+		if name, ok := result.Value()["table_name"].(string); ok {
+			measurements = append(measurements, name)
 		}
-		avg := sum / float64(len(vals))
-		aggregatedValues = append(aggregatedValues, model.TimeSeriesValue{
-			Time:  t.In(easternZone).Format("15:04"),
-			Value: avg,
-		})
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
 	}
 
-	sort.Slice(aggregatedValues, func(i, j int) bool {
-		return aggregatedValues[i].Time < aggregatedValues[j].Time
-	})
+	return measurements, nil
+}
 
-	return aggregatedValues, nil
+// syncMeasurements are the measurements the sync client writes and the API reads
+var syncMeasurements = []string{
+	"active_energy", "blood_glucose", "blood_oxygen", "blood_pressure",
+	"body_fat_percentage", "daily_totals", "dietary_energy", "heart_rate",
+	"heart_rate_variability", "respiratory_rate", "resting_heart_rate",
+	"sleep_analysis", "step_count", "vo2_max", "weight_body_mass", "workout",
+	"body_temperature", "wrist_temperature",
 }
 
-func (s *InfluxDBStore) GetVitalsBP(endDate string) ([]model.BloodPressure, error) {
-	start, stop := getDaysRangeUTC(endDate, 30)
+// GetLastIngestTime returns the newest point in each sync measurement and the
+// newest overall. Measurements that have never been written are left out.
+func (s *InfluxDBStore) GetLastIngestTime(ctx context.Context) (*model.SyncStatus, error) {
+	existing, err := s.GetMeasurements(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Printf("Querying blood pressure: start=%s, stop=%s", start, stop)
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	sqlQuery := fmt.Sprintf(`
-SELECT time, systolic, diastolic
-FROM "blood_pressure"
-WHERE time > '%s' AND time <= '%s'
-ORDER BY time ASC`, start, stop)
+	// Querying a table that doesn't exist fails the whole UNION, so only
+	// include measurements that have been created
+	var selects []string
+	for _, measurement := range syncMeasurements {
+		if slices.Contains(existing, measurement) {
+			selects = append(selects, fmt.Sprintf(`SELECT '%s' AS measurement, max(time) AS last_sync FROM "%s"`, measurement, measurement))
+		}
+	}
+	status := &model.SyncStatus{Measurements: []model.MeasurementSync{}}
+	if len(selects) == 0 {
+		return status, nil
+	}
 
-	result, err := s.query(context.Background(), sqlQuery)
+	sqlQuery := strings.Join(selects, "\nUNION ALL\n") + "\nORDER BY measurement ASC"
+	result, err := s.query(ctx, sqlQuery, nil)
 	if err != nil {
-		log.Printf("Blood pressure query error: %v", err)
 		return nil, err
 	}
-
-	var bps []model.BloodPressure
 	for result.Next() {
 		record := result.Value()
-
-		// Handle both int64 and float64 types from InfluxDB
-		var systolic, diastolic int
-
-		switch v := record["systolic"].(type) {
-		case int64:
-			systolic = int(v)
-		case float64:
-			systolic = int(v)
-		default:
-			log.Printf("Unexpected systolic type: %T", v)
-			continue
-		}
-
-		switch v := record["diastolic"].(type) {
-		case int64:
-			diastolic = int(v)
-		case float64:
-			diastolic = int(v)
-		default:
-			log.Printf("Unexpected diastolic type: %T", v)
-			continue
-		}
-
-		t, okTime := record["time"].(time.Time)
-		if !okTime {
-			log.Printf("Invalid time in blood pressure record")
+		measurement, _ := record["measurement"].(string)
+		// max(time) is null for a table scoped down to no rows
+		t, ok := record["last_sync"].(time.Time)
+		if !ok {
 			continue
 		}
-
-		bp := model.BloodPressure{
-			Time:      t.In(easternZone).Format("Jan 02"),
-			Systolic:  systolic,
-			Diastolic: diastolic,
-			Category:  getBPCategory(systolic, diastolic),
+		status.Measurements = append(status.Measurements, model.MeasurementSync{
+			Measurement: measurement,
+			LastSync:    t,
+		})
+		if status.LastSync == nil || t.After(*status.LastSync) {
+			status.LastSync = &t
 		}
-		bps = append(bps, bp)
 	}
-
 	if result.Err() != nil {
-		log.Printf("Blood pressure iteration error: %v", result.Err())
 		return nil, result.Err()
 	}
 
-	log.Printf("Found %d blood pressure records", len(bps))
-	return bps, nil
+	return status, nil
 }
 
-func (s *InfluxDBStore) GetVitalsGlucose(endDate string) ([]model.Glucose, error) {
-	start, stop := getDaysRangeUTC(endDate, 30)
-	sqlQuery := fmt.Sprintf(`
-SELECT time, qty as value
-FROM "blood_glucose"
-WHERE time > '%s' AND time <= '%s'
-ORDER BY time ASC`, start, stop)
+func (s *InfluxDBStore) GetVitalsHR(ctx context.Context, date string, opts model.HROptions) ([]model.HRBucket, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := hrWindowUTC(date, time.Now(), s.loc)
+
+	sqlQuery := `
+SELECT time, "avg" as value
+FROM "heart_rate"
+WHERE time > $start AND time <= $stop
+ORDER BY time`
 
-	result, err := s.query(context.Background(), sqlQuery)
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
 	if err != nil {
 		return nil, err
 	}
 
-	var glucoses []model.Glucose
+	var readings []hrSample
 	for result.Next() {
 		record := result.Value()
-		value, okVal := record["value"].(float64)
+		val, okVal := record["value"].(float64)
 		t, okTime := record["time"].(time.Time)
 		if okVal && okTime {
-			glucoses = append(glucoses, model.Glucose{
-				Time:  t.In(easternZone).Format("Jan 02"),
-				Value: value,
-			})
+			readings = append(readings, hrSample{time: t, value: val})
 		}
 	}
-
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 
-	return glucoses, nil
-}
-
-func (s *InfluxDBStore) GetSleep(endDate string) ([]model.Sleep, error) {
-	start, stop := getDaysRangeUTC(endDate, 7)
-	sqlQuery := fmt.Sprintf(`
-SELECT time, "totalSleep", "deep", "rem", "core", "awake"
-FROM "sleep_analysis"
-WHERE time > '%s' AND time <= '%s'
-ORDER BY time ASC`, start, stop)
-
-	result, err := s.query(context.Background(), sqlQuery)
-	if err != nil {
-		return nil, err
+	// Raw mode returns every reading at full resolution, unless that's more
+	// than the point cap
+	if opts.Raw && (opts.MaxPoints <= 0 || len(readings) <= opts.MaxPoints) {
+		values := make([]model.HRBucket, 0, len(readings))
+		for _, r := range readings {
+			values = append(values, model.HRBucket{Time: tf.instant(r.time, time.RFC3339), Value: r.value})
+		}
+		return values, nil
 	}
 
-	var sleeps []model.Sleep
-	for result.Next() {
-		record := result.Value()
-		t, okTime := record["time"].(time.Time)
-		total, okTotal := record["totalSleep"].(float64)
-		deep, okDeep := record["deep"].(float64)
-		rem, okRem := record["rem"].(float64)
-		light, okLight := record["core"].(float64)
-		awake, okAwake := record["awake"].(float64)
-
-		if okTime && okTotal && okDeep && okRem && okLight && okAwake {
-			sleeps = append(sleeps, model.Sleep{
-				Date:          t.In(easternZone).Format("Jan 02"),
-				TotalDuration: total,
-				DeepSleep:     deep,
-				RemSleep:      rem,
-				LightSleep:    light,
-				Awake:         awake,
-				Efficiency:    95, // Hardcoded as per python
-			})
+	bucket := opts.Bucket
+	if bucket <= 0 {
+		bucket = model.DefaultHRBucket
+	}
+	if opts.MaxPoints > 0 {
+		// Raw readings over the cap keep as much resolution as it allows
+		if opts.Raw {
+			bucket = time.Minute
 		}
+		startTime, _ := time.Parse(time.RFC3339, start)
+		stopTime, _ := time.Parse(time.RFC3339, stop)
+		bucket = capBuckets(stopTime.Sub(startTime), bucket, opts.MaxPoints)
 	}
 
+	// Aggregate into fixed-width buckets
+	buckets := make(map[time.Time][]float64)
+	for _, r := range readings {
+		bucketTime := r.time.Truncate(bucket)
+		buckets[bucketTime] = append(buckets[bucketTime], r.value)
+	}
+
+	// Sort on the bucket time itself; the formatted "15:04" labels don't order
+	// correctly once the rolling window crosses midnight
+	bucketTimes := make([]time.Time, 0, len(buckets))
+	for t := range buckets {
+		bucketTimes = append(bucketTimes, t)
+	}
+	sort.Slice(bucketTimes, func(i, j int) bool {
+		return bucketTimes[i].Before(bucketTimes[j])
+	})
+
+	var aggregatedValues []model.HRBucket
+	for _, t := range bucketTimes {
+		vals := buckets[t]
+		var sum float64
+		minVal, maxVal := vals[0], vals[0]
+		for _, v := range vals {
+			sum += v
+			minVal = min(minVal, v)
+			maxVal = max(maxVal, v)
+		}
+		avg := sum / float64(len(vals))
+		aggregatedValues = append(aggregatedValues, model.HRBucket{
+			Time:  tf.instant(t, "15:04"),
+			Value: avg,
+			Min:   &minVal,
+			Max:   &maxVal,
+		})
+	}
+
+	return aggregatedValues, nil
+}
+
+// hrBucketSteps are the bucket widths capBuckets widens to, so adaptive
+// buckets still land on round clock times
+var hrBucketSteps = []time.Duration{
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute,
+	15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+	3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// capBuckets widens bucket until window splits into at most maxPoints
+// buckets, like Grafana's maxDataPoints. Buckets are aligned to the clock
+// rather than the window, so a window can straddle one more bucket than it
+// spans.
+func capBuckets(window, bucket time.Duration, maxPoints int) time.Duration {
+	if window <= 0 {
+		return bucket
+	}
+	required := window
+	if maxPoints > 1 {
+		required = (window + time.Duration(maxPoints-2)) / time.Duration(maxPoints-1)
+	}
+	if bucket >= required {
+		return bucket
+	}
+	for _, step := range hrBucketSteps {
+		if step >= required {
+			return step
+		}
+	}
+	return required.Truncate(time.Hour) + time.Hour
+}
+
+// GetLatestHR returns the newest heart rate reading of the last day, or
+// model.ErrNotFound if there isn't one
+func (s *InfluxDBStore) GetLatestHR(ctx context.Context) (*model.HRBucket, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	// Bound the scan; a reading older than a day isn't "live"
+	sqlQuery := `
+SELECT time, "avg" as value
+FROM "heart_rate"
+WHERE time > now() - INTERVAL '1 day'
+ORDER BY time DESC
+LIMIT 1`
+
+	result, err := s.query(ctx, sqlQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	var latest *model.HRBucket
+	for result.Next() {
+		record := result.Value()
+		val, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			latest = &model.HRBucket{
+				Time:  tf.instant(t, time.RFC3339),
+				Value: val,
+			}
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	if latest == nil {
+		return nil, model.ErrNotFound
+	}
+	return latest, nil
+}
+
+func (s *InfluxDBStore) GetHRDailyStats(ctx context.Context, startDate, endDate string) ([]model.HRDailyStat, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+
+	start, stop := getRangeUTC(startDate, endDate, s.windows.HRDaily, s.loc)
+	sqlQuery := `
+SELECT time, "avg" as value
+FROM "heart_rate"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	statsByDay := make(map[string]*model.HRDailyStat)
+	counts := make(map[string]int)
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if !okVal || !okTime {
+			continue
+		}
+
+		dayStr := t.In(s.loc).Format("2006-01-02")
+		stat, ok := statsByDay[dayStr]
+		if !ok {
+			stat = &model.HRDailyStat{Min: value, Max: value}
+			statsByDay[dayStr] = stat
+		}
+		stat.Min = math.Min(stat.Min, value)
+		stat.Max = math.Max(stat.Max, value)
+		stat.Avg += value
+		counts[dayStr]++
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	// Resting HR is optional; not every device reports it
+	restingQuery := `
+SELECT time, qty as value
+FROM "resting_heart_rate"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	resting := make(map[string]float64)
+	restingResult, err := s.query(ctx, restingQuery, rangeParams(start, stop))
+	if err != nil {
+		log.Printf("Resting heart rate unavailable: %v", err)
+	} else {
+		for restingResult.Next() {
+			record := restingResult.Value()
+			value, okVal := record["value"].(float64)
+			t, okTime := record["time"].(time.Time)
+			if okVal && okTime {
+				resting[t.In(s.loc).Format("2006-01-02")] = value
+			}
+		}
+		if restingResult.Err() != nil {
+			log.Printf("Resting heart rate iteration error: %v", restingResult.Err())
+		}
+	}
+
+	var sortedDays []string
+	for dayStr := range statsByDay {
+		sortedDays = append(sortedDays, dayStr)
+	}
+	sort.Strings(sortedDays)
+
+	var stats []model.HRDailyStat
+	for _, dayStr := range sortedDays {
+		stat := statsByDay[dayStr]
+		stat.Avg /= float64(counts[dayStr])
+		if value, ok := resting[dayStr]; ok {
+			stat.Resting = &value
+		}
+
+		d, _ := time.ParseInLocation("2006-01-02", dayStr, s.loc)
+		stat.Date = tf.day(d, "Jan 02")
+		stats = append(stats, *stat)
+	}
+
+	return stats, nil
+}
+
+func (s *InfluxDBStore) GetStepsSeries(ctx context.Context, date string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	start, stop := getDayRangeUTC(date, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "step_count"
+WHERE time >= $start AND time < $stop
+ORDER BY time`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps are a count, so sum within each hourly bucket rather than averaging
+	return s.hourlySums(result, s.timeFormat(ctx))
+}
+
+// GetActiveEnergySeries returns the day's active calories summed per hour,
+// counting only readings from source so devices aren't double counted
+func (s *InfluxDBStore) GetActiveEnergySeries(ctx context.Context, date, source string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	start, stop := getDayRangeUTC(date, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "active_energy"
+WHERE time >= $start AND time < $stop AND source = $source
+ORDER BY time`
+
+	params := rangeParams(start, stop)
+	params["source"] = source
+	result, err := s.query(ctx, sqlQuery, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.hourlySums(result, s.timeFormat(ctx))
+}
+
+// GetDistanceSeries returns the walking and running distance, in km, summed
+// per local day over the distance window ending on endDate
+func (s *InfluxDBStore) GetDistanceSeries(ctx context.Context, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC("", endDate, s.windows.Distance, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "walking_running_distance"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows are time ordered, so each new local day starts a new total
+	distances := []model.TimeSeriesValue{}
+	lastDay := ""
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		if !okTime {
+			continue
+		}
+		var value float64
+		switch v := record["value"].(type) {
+		case float64:
+			value = v
+		case int64:
+			value = float64(v)
+		default:
+			continue
+		}
+
+		local := t.In(s.loc)
+		if dayStr := local.Format("2006-01-02"); dayStr != lastDay {
+			lastDay = dayStr
+			day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.loc)
+			distances = append(distances, model.TimeSeriesValue{Time: tf.day(day, "Jan 02")})
+		}
+		distances[len(distances)-1].Value += value
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return distances, nil
+}
+
+// hourlySums totals each row's value into hourly buckets, labelled per tf
+func (s *InfluxDBStore) hourlySums(result *influxdb3.QueryIterator, tf timeFormat) ([]model.TimeSeriesValue, error) {
+	buckets := make(map[time.Time]float64)
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		if !okTime {
+			continue
+		}
+
+		var value float64
+		switch v := record["value"].(type) {
+		case float64:
+			value = v
+		case int64:
+			value = float64(v)
+		default:
+			continue
+		}
+
+		bucketTime := t.Truncate(time.Hour)
+		buckets[bucketTime] += value
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	bucketTimes := make([]time.Time, 0, len(buckets))
+	for t := range buckets {
+		bucketTimes = append(bucketTimes, t)
+	}
+	sort.Slice(bucketTimes, func(i, j int) bool {
+		return bucketTimes[i].Before(bucketTimes[j])
+	})
+
+	var series []model.TimeSeriesValue
+	for _, t := range bucketTimes {
+		series = append(series, model.TimeSeriesValue{
+			Time:  tf.instant(t, "15:04"),
+			Value: buckets[t],
+		})
+	}
+
+	return series, nil
+}
+
+func (s *InfluxDBStore) GetVitalsBP(ctx context.Context, startDate, endDate string, standard model.BPStandard) ([]model.BloodPressure, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.BloodPressure, s.loc)
+
+	slog.DebugContext(ctx, "querying blood pressure", slog.String("start", start), slog.String("stop", stop))
+
+	sqlQuery := `
+SELECT time, systolic, diastolic
+FROM "blood_pressure"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		log.Printf("Blood pressure query error: %v", err)
+		return nil, err
+	}
+
+	var bps []model.BloodPressure
+	for result.Next() {
+		record := result.Value()
+
+		// Handle both int64 and float64 types from InfluxDB
+		var systolic, diastolic int
+
+		switch v := record["systolic"].(type) {
+		case int64:
+			systolic = int(v)
+		case float64:
+			systolic = int(v)
+		default:
+			slog.DebugContext(ctx, "unexpected systolic type", slog.String("type", fmt.Sprintf("%T", v)))
+			continue
+		}
+
+		switch v := record["diastolic"].(type) {
+		case int64:
+			diastolic = int(v)
+		case float64:
+			diastolic = int(v)
+		default:
+			slog.DebugContext(ctx, "unexpected diastolic type", slog.String("type", fmt.Sprintf("%T", v)))
+			continue
+		}
+
+		t, okTime := record["time"].(time.Time)
+		if !okTime {
+			slog.DebugContext(ctx, "invalid time in blood pressure record")
+			continue
+		}
+
+		bp := model.BloodPressure{
+			Time:      tf.instant(t, "Jan 02"),
+			Systolic:  systolic,
+			Diastolic: diastolic,
+			Category:  getBPCategory(standard, systolic, diastolic),
+		}
+		bps = append(bps, bp)
+	}
+
+	if result.Err() != nil {
+		log.Printf("Blood pressure iteration error: %v", result.Err())
+		return nil, result.Err()
+	}
+
+	slog.DebugContext(ctx, "found blood pressure records", slog.Int("count", len(bps)))
+	return bps, nil
+}
+
+func (s *InfluxDBStore) GetVitalsGlucose(ctx context.Context, startDate, endDate string) ([]model.Glucose, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.Glucose, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "blood_glucose"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var glucoses []model.Glucose
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			glucoses = append(glucoses, model.Glucose{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return glucoses, nil
+}
+
+// GetGlucoseDaily returns the min, max and average glucose for each local day
+func (s *InfluxDBStore) GetGlucoseDaily(ctx context.Context, startDate, endDate string) ([]model.GlucoseDaily, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.Glucose, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "blood_glucose"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows arrive in time order, so days do too
+	var days []model.GlucoseDaily
+	var current string
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if !okVal || !okTime {
+			continue
+		}
+
+		dayStr := t.In(s.loc).Format("2006-01-02")
+		if dayStr != current {
+			current = dayStr
+			days = append(days, model.GlucoseDaily{
+				Date: tf.day(t.In(s.loc), "Jan 02"),
+				Min:  value,
+				Max:  value,
+			})
+		}
+		day := &days[len(days)-1]
+		day.Min = math.Min(day.Min, value)
+		day.Max = math.Max(day.Max, value)
+		day.Avg += value
+		day.Count++
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	for i := range days {
+		days[i].Avg /= float64(days[i].Count)
+	}
+	return days, nil
+}
+
+// GetGlucoseStats summarizes the same readings GetVitalsGlucose returns
+func (s *InfluxDBStore) GetGlucoseStats(ctx context.Context, startDate, endDate string, target model.GlucoseRange) (*model.GlucoseStats, error) {
+	glucoses, err := s.GetVitalsGlucose(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return glucoseStats(glucoses, target), nil
+}
+
+func (s *InfluxDBStore) GetVitalsSpo2(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.Spo2, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "blood_oxygen"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var spo2 []model.TimeSeriesValue
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			// Some sources report saturation as a fraction rather than a percentage
+			if value <= 1 {
+				value *= 100
+			}
+			spo2 = append(spo2, model.TimeSeriesValue{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return spo2, nil
+}
+
+// temperatureMeasurements are tried in order; devices write one or the other
+var temperatureMeasurements = []string{"body_temperature", "wrist_temperature"}
+
+// GetBodyTemperature returns temperature readings in °C from the first
+// measurement in temperatureMeasurements that has data in the range
+func (s *InfluxDBStore) GetBodyTemperature(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.BodyTemperature, s.loc)
+
+	var lastErr error
+	for _, measurement := range temperatureMeasurements {
+		sqlQuery := fmt.Sprintf(`
+SELECT time, qty as value
+FROM "%s"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`, measurement)
+
+		// A measurement that has never been written doesn't exist yet
+		result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var temperatures []model.TimeSeriesValue
+		for result.Next() {
+			record := result.Value()
+			value, okVal := record["value"].(float64)
+			t, okTime := record["time"].(time.Time)
+			if okVal && okTime {
+				temperatures = append(temperatures, model.TimeSeriesValue{
+					Time:  tf.instant(t, "Jan 02"),
+					Value: value,
+				})
+			}
+		}
+		if result.Err() != nil {
+			return nil, result.Err()
+		}
+		if len(temperatures) > 0 {
+			return temperatures, nil
+		}
+		lastErr = nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, nil
+}
+
+func (s *InfluxDBStore) GetVitalsHRV(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.HRV, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "heart_rate_variability"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	// HRV is noisy intraday, so collapse readings into one average per local day
+	dailyReadings := make(map[string][]float64)
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			dayStr := t.In(s.loc).Format("2006-01-02")
+			dailyReadings[dayStr] = append(dailyReadings[dayStr], value)
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var sortedDays []string
+	for dayStr := range dailyReadings {
+		sortedDays = append(sortedDays, dayStr)
+	}
+	sort.Strings(sortedDays)
+
+	var hrv []model.TimeSeriesValue
+	for _, dayStr := range sortedDays {
+		readings := dailyReadings[dayStr]
+		if len(readings) == 0 {
+			continue
+		}
+
+		var sum float64
+		for _, v := range readings {
+			sum += v
+		}
+
+		d, _ := time.ParseInLocation("2006-01-02", dayStr, s.loc)
+		hrv = append(hrv, model.TimeSeriesValue{
+			Time:  tf.day(d, "Jan 02"),
+			Value: sum / float64(len(readings)),
+		})
+	}
+
+	return hrv, nil
+}
+
+func (s *InfluxDBStore) GetVitalsRespiratoryRate(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.RespiratoryRate, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "respiratory_rate"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []model.TimeSeriesValue
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			rates = append(rates, model.TimeSeriesValue{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return rates, nil
+}
+
+func (s *InfluxDBStore) GetVitalsVO2Max(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	// VO2 max is sampled infrequently, so use a wider window and return every reading
+	start, stop := getRangeUTC(startDate, endDate, s.windows.VO2Max, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "vo2_max"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var vo2Max []model.TimeSeriesValue
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			vo2Max = append(vo2Max, model.TimeSeriesValue{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return vo2Max, nil
+}
+
+// GetRestingHR returns one resting heart rate per local day. Sources may
+// resend the day's value as it's refined, so the latest reading wins.
+func (s *InfluxDBStore) GetRestingHR(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.RestingHR, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "resting_heart_rate"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var restingHR []model.TimeSeriesValue
+	lastDay := ""
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if !okVal || !okTime {
+			continue
+		}
+		// Rows are time ordered, so a repeat day is always the previous entry
+		dayStr := t.In(s.loc).Format("2006-01-02")
+		if dayStr == lastDay {
+			restingHR[len(restingHR)-1].Value = value
+			continue
+		}
+		lastDay = dayStr
+		restingHR = append(restingHR, model.TimeSeriesValue{
+			Time:  tf.instant(t, "Jan 02"),
+			Value: value,
+		})
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return restingHR, nil
+}
+
+// sleepWindowDays returns the default sleep window for interval
+func (s *InfluxDBStore) sleepWindowDays(interval model.Interval) int {
+	switch interval {
+	case model.IntervalWeek:
+		return s.windows.SleepWeekly
+	case model.IntervalMonth:
+		return s.windows.SleepMonthly
+	default:
+		return s.windows.Sleep
+	}
+}
+
+// GetSleep returns one row per night, or per-week/month averages of the nights
+// recorded in each bucket
+func (s *InfluxDBStore) GetSleep(ctx context.Context, startDate, endDate string, interval model.Interval) ([]model.Sleep, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.sleepWindowDays(interval), s.loc)
+	sqlQuery := `
+SELECT time, "totalSleep", "deep", "rem", "core", "awake"
+FROM "sleep_analysis"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	var sleeps []model.Sleep
+	var nightTimes []time.Time
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		total, okTotal := record["totalSleep"].(float64)
+		deep, okDeep := record["deep"].(float64)
+		rem, okRem := record["rem"].(float64)
+		light, okLight := record["core"].(float64)
+		awake, okAwake := record["awake"].(float64)
+
+		if okTime && okTotal && okDeep && okRem && okLight && okAwake {
+			sleeps = append(sleeps, model.Sleep{
+				Date:          tf.day(t.In(s.loc), "Jan 02"),
+				TotalDuration: total,
+				DeepSleep:     deep,
+				RemSleep:      rem,
+				LightSleep:    light,
+				Awake:         awake,
+				Efficiency:    sleepEfficiency(total, awake),
+			})
+			nightTimes = append(nightTimes, t.In(s.loc))
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	if interval == model.IntervalWeek || interval == model.IntervalMonth {
+		return averageSleep(sleeps, nightTimes, interval, tf), nil
+	}
+	return sleeps, nil
+}
+
+// nightCutoffHour splits one night from the next: a night belongs to the date
+// it ends on and runs from 18:00 the evening before to 18:00 that day
+const nightCutoffHour = 18
+
+// GetSleepStages returns the stage timeline of the night ending on date, in
+// time order. Nights cross midnight, so the window runs from the previous
+// evening rather than over the calendar day. "In bed" rows span the whole
+// night underneath the stages and are left out.
+func (s *InfluxDBStore) GetSleepStages(ctx context.Context, date string) ([]model.SleepStageSegment, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getNightRangeUTC(date, s.loc)
+	// Unaggregated sleep rows carry the stage in value and its length in
+	// hours in qty; aggregated nightly totals have no value and are skipped
+	sqlQuery := `
+SELECT time, "value" AS stage, qty
+FROM "sleep_analysis"
+WHERE time >= $start AND time < $stop AND "value" IS NOT NULL
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []model.SleepStageSegment{}
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		rawStage, okStage := record["stage"].(string)
+		hours, okQty := record["qty"].(float64)
+		if !okTime || !okStage || !okQty || hours <= 0 {
+			continue
+		}
+		stage := normalizeSleepStage(rawStage)
+		if stage == "in_bed" {
+			continue
+		}
+		segments = append(segments, model.SleepStageSegment{
+			Start: tf.in(t),
+			End:   tf.in(t.Add(time.Duration(hours * float64(time.Hour)))),
+			Stage: stage,
+		})
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return segments, nil
+}
+
+// normalizeSleepStage maps exporter stage names ("Core", "REM", "In Bed",
+// "inBed", ...) to lowercase snake_case
+func normalizeSleepStage(stage string) string {
+	switch strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(stage)) {
+	case "inbed":
+		return "in_bed"
+	case "asleep", "asleepunspecified":
+		return "asleep"
+	case "awake":
+		return "awake"
+	case "rem":
+		return "rem"
+	case "core", "light":
+		return "core"
+	case "deep":
+		return "deep"
+	default:
+		return strings.ToLower(stage)
+	}
+}
+
+// GetWorkouts returns workouts in the range, optionally only those named
+// workoutType; an empty workoutType returns every workout
+func (s *InfluxDBStore) GetWorkouts(ctx context.Context, startDate, date, workoutType string, page model.Pagination) (*model.WorkoutPage, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, date, s.windows.Workouts, s.loc)
+	where, params := workoutFilter(start, stop, workoutType)
+	sqlQuery := workoutRowsQuery(where)
+	if page.Limit > 0 {
+		sqlQuery += fmt.Sprintf("\nLIMIT %d", page.Limit)
+	}
+	if page.Offset > 0 {
+		sqlQuery += fmt.Sprintf("\nOFFSET %d", page.Offset)
+	}
+
+	result, err := s.query(ctx, sqlQuery, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+	for result.Next() {
+		records = append(records, result.Value())
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	workoutsMap, workoutIDs := s.collectWorkouts(records, tf)
+
+	hrQuery := `
+        SELECT workout_id, avg("avg") as avg_hr
+        FROM "workout_heart_rate"
+        WHERE time > $start AND time <= $stop
+        GROUP BY workout_id`
+
+	hrResult, err := s.query(ctx, hrQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	for hrResult.Next() {
+		record := hrResult.Value()
+		workoutID, _ := record["workout_id"].(string)
+		avgHr, _ := record["avg_hr"].(float64)
+
+		if workout, ok := workoutsMap[workoutID]; ok {
+			workout.AvgHr = int(avgHr)
+			workoutsMap[workoutID] = workout
+		}
+	}
+	if hrResult.Err() != nil {
+		return nil, hrResult.Err()
+	}
+
+	distances := s.workoutDistances(ctx, where, params)
+	var workouts []model.Workout
+	for _, id := range workoutIDs {
+		workout := workoutsMap[id]
+		if d, ok := distances[id]; ok {
+			workout.Distance, workout.Pace = d.km, d.pace
+		}
+		workouts = append(workouts, workout)
+	}
+
+	total := len(workouts)
+	if page.Limit > 0 || page.Offset > 0 {
+		total, err = s.countWorkouts(ctx, where, params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.WorkoutPage{
+		Workouts: workouts,
+		Total:    total,
+		Offset:   page.Offset,
+	}, nil
+}
+
+// collectWorkouts keys workout rows by workout_id, returning the IDs in row
+// order. workoutRowsQuery already groups by workout_id, so a repeated ID only
+// keeps its first row.
+func (s *InfluxDBStore) collectWorkouts(records []map[string]interface{}, tf timeFormat) (map[string]model.Workout, []string) {
+	workoutsMap := make(map[string]model.Workout)
+	var workoutIDs []string
+	for _, record := range records {
+		workout := s.workoutFromRecord(record, tf)
+		if _, seen := workoutsMap[workout.ID]; seen {
+			continue
+		}
+		workoutsMap[workout.ID] = workout
+		workoutIDs = append(workoutIDs, workout.ID)
+	}
+	return workoutsMap, workoutIDs
+}
+
+// workoutRowsQuery selects one row per workout matching where, oldest first. A
+// workout can be written as several rows (e.g. re-exported by the sync
+// client), so rows are collapsed by workout_id before paging. The rows repeat
+// the workout totals rather than splitting them, so take the max instead of
+// summing.
+func workoutRowsQuery(where string) string {
+	return `
+SELECT workout_id, min(time) AS start_time, max(workout_name) AS workout_name,
+       max(duration) AS duration, max(active_energy_value) AS active_energy_value
+FROM "workout"
+WHERE ` + where + `
+GROUP BY workout_id
+ORDER BY start_time ASC`
+}
+
+// GetWorkoutWeeklyVolume returns the workout totals of each ISO week in the
+// workouts window ending on endDate
+func (s *InfluxDBStore) GetWorkoutWeeklyVolume(ctx context.Context, endDate string) ([]model.WorkoutWeek, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	start, stop := getRangeUTC("", endDate, s.windows.Workouts, s.loc)
+	where, params := workoutFilter(start, stop, "")
+
+	result, err := s.query(ctx, workoutRowsQuery(where), params)
+	if err != nil {
+		return nil, err
+	}
+	var workouts []startedWorkout
+	for result.Next() {
+		record := result.Value()
+		start, ok := record["start_time"].(time.Time)
+		if !ok {
+			continue
+		}
+		workouts = append(workouts, startedWorkout{
+			start:   start.In(s.loc),
+			workout: s.workoutFromRecord(record, timeFormat{loc: s.loc}),
+		})
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	return groupWorkoutWeeks(workouts), nil
+}
+
+// startedWorkout pairs a workout with its local start time, so grouping never
+// depends on the display label's format
+type startedWorkout struct {
+	start   time.Time
+	workout model.Workout
+}
+
+// groupWorkoutWeeks sums workouts, which must be in time order, by the ISO week
+// of their local start time
+func groupWorkoutWeeks(workouts []startedWorkout) []model.WorkoutWeek {
+	weeks := []model.WorkoutWeek{}
+	for _, started := range workouts {
+		t, workout := started.start, started.workout
+		year, week := t.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		if len(weeks) == 0 || weeks[len(weeks)-1].Week != key {
+			monday := t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+			weeks = append(weeks, model.WorkoutWeek{Week: key, StartDate: monday.Format("2006-01-02")})
+		}
+		w := &weeks[len(weeks)-1]
+		w.Duration += workout.Duration
+		w.Calories += workout.Calories
+		w.Count++
+	}
+	return weeks
+}
+
+// workoutFromRecord converts a row of the grouped workout query
+func (s *InfluxDBStore) workoutFromRecord(record map[string]interface{}, tf timeFormat) model.Workout {
+	workoutID, _ := record["workout_id"].(string)
+	t, _ := record["start_time"].(time.Time)
+	name, _ := record["workout_name"].(string)
+	duration := workoutNumber(record["duration"])
+	calories := workoutNumber(record["active_energy_value"])
+
+	return model.Workout{
+		ID:       workoutID,
+		Time:     tf.instant(t, "2006-01-02 15:04"),
+		Name:     name,
+		Duration: int(duration / 60),
+		Calories: calories,
+		Type:     name,
+	}
+}
+
+// workoutNumber reads a numeric workout column. Depending on how the sync
+// client first wrote the table, InfluxDB returns these fields as either int64
+// or float64; anything else reads as zero.
+func workoutNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+// workoutDistance is a workout's distance in km and pace in minutes per km
+type workoutDistance struct {
+	km   float64
+	pace float64
+}
+
+// workoutDistances returns the distance and pace of each workout matching
+// where. Distance fields only exist once a distance workout has been written,
+// so a failed query is logged and treated as no distances.
+func (s *InfluxDBStore) workoutDistances(ctx context.Context, where string, params influxdb3.QueryParameters) map[string]workoutDistance {
+	sqlQuery := `
+SELECT workout_id, max(distance_value) AS distance, max(distance_units) AS distance_units,
+       max(duration) AS duration
+FROM "workout"
+WHERE ` + where + `
+GROUP BY workout_id`
+
+	distances := make(map[string]workoutDistance)
+	result, err := s.query(ctx, sqlQuery, params)
+	if err != nil {
+		log.Printf("Workout distances unavailable: %v", err)
+		return distances
+	}
+	for result.Next() {
+		record := result.Value()
+		workoutID, _ := record["workout_id"].(string)
+		distance := workoutNumber(record["distance"])
+		units, _ := record["distance_units"].(string)
+		duration := workoutNumber(record["duration"])
+
+		switch units {
+		case "mi":
+			distance *= 1.609344
+		case "m":
+			distance /= 1000
+		}
+		// Strength and other stationary workouts have no distance to pace against
+		if distance <= 0 {
+			continue
+		}
+		distances[workoutID] = workoutDistance{
+			km:   distance,
+			pace: duration / 60 / distance,
+		}
+	}
+	if result.Err() != nil {
+		log.Printf("Workout distances iteration error: %v", result.Err())
+	}
+	return distances
+}
+
+// GetWorkoutDetail returns a single workout with its full heart rate series,
+// or model.ErrNotFound if no workout has that ID
+func (s *InfluxDBStore) GetWorkoutDetail(ctx context.Context, workoutID string, zones model.HRZones) (*model.WorkoutDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	params := influxdb3.QueryParameters{"workout_id": workoutID}
+
+	// Same row collapsing as GetWorkouts
+	workoutQuery := `
+SELECT workout_id, min(time) AS start_time, max(workout_name) AS workout_name,
+       max(duration) AS duration, max(active_energy_value) AS active_energy_value
+FROM "workout"
+WHERE workout_id = $workout_id
+GROUP BY workout_id`
+
+	result, err := s.query(ctx, workoutQuery, params)
+	if err != nil {
+		return nil, err
+	}
+	var detail *model.WorkoutDetail
+	for result.Next() {
+		detail = &model.WorkoutDetail{Workout: s.workoutFromRecord(result.Value(), tf)}
+	}
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
+	if detail == nil {
+		return nil, model.ErrNotFound
+	}
+	if d, ok := s.workoutDistances(ctx, "workout_id = $workout_id", params)[workoutID]; ok {
+		detail.Distance, detail.Pace = d.km, d.pace
+	}
+
+	hrQuery := `
+SELECT time, "avg" AS value
+FROM "workout_heart_rate"
+WHERE workout_id = $workout_id
+ORDER BY time ASC`
+
+	hrResult, err := s.query(ctx, hrQuery, params)
+	if err != nil {
+		return nil, err
+	}
+
+	detail.HeartRate = []model.TimeSeriesValue{}
+	var samples []hrSample
+	var sum float64
+	for hrResult.Next() {
+		record := hrResult.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if !okVal || !okTime {
+			continue
+		}
+		detail.HeartRate = append(detail.HeartRate, model.TimeSeriesValue{
+			Time:  tf.instant(t, "15:04:05"),
+			Value: value,
+		})
+		if len(detail.HeartRate) == 1 || value < detail.MinHr {
+			detail.MinHr = value
+		}
+		if value > detail.MaxHr {
+			detail.MaxHr = value
+		}
+		sum += value
+		samples = append(samples, hrSample{time: t, value: value})
+	}
+	if hrResult.Err() != nil {
+		return nil, hrResult.Err()
+	}
+	if n := len(detail.HeartRate); n > 0 {
+		detail.AvgHr = int(math.Round(sum / float64(n)))
+	}
+	detail.Zones = workoutZones(samples, zones)
 
-	return sleeps, nil
+	return detail, nil
 }
 
-func (s *InfluxDBStore) GetWorkouts(date string) ([]model.Workout, error) {
-	start, stop := getDaysRangeUTC(date, 90)
-	sqlQuery := fmt.Sprintf(`
-SELECT workout_id, time, workout_name, duration, active_energy_value
+// GetWorkoutTypes lists the distinct workout names that have been recorded
+func (s *InfluxDBStore) GetWorkoutTypes(ctx context.Context) ([]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	sqlQuery := `
+SELECT DISTINCT workout_name
 FROM "workout"
-WHERE time > '%s' AND time <= '%s'
-ORDER BY time ASC`, start, stop)
+WHERE workout_name IS NOT NULL
+ORDER BY workout_name ASC`
 
-	result, err := s.query(context.Background(), sqlQuery)
+	result, err := s.query(ctx, sqlQuery, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	workoutsMap := make(map[string]model.Workout)
-	var workoutIDs []string
+	types := []string{}
 	for result.Next() {
-		record := result.Value()
-		workoutID, _ := record["workout_id"].(string)
-		t, _ := record["time"].(time.Time)
-		name, _ := record["workout_name"].(string)
-		duration, _ := record["duration"].(int64)
-		calories, _ := record["active_energy_value"].(int64)
-
-		workoutsMap[workoutID] = model.Workout{
-			ID:       workoutID,
-			Time:     t.In(easternZone).Format("2006-01-02 15:04"),
-			Name:     name,
-			Duration: int(duration / 60),
-			Calories: float64(calories),
-			Type:     name,
+		if name, ok := result.Value()["workout_name"].(string); ok && name != "" {
+			types = append(types, name)
 		}
-		workoutIDs = append(workoutIDs, workoutID)
 	}
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 
-	hrQuery := fmt.Sprintf(`
-        SELECT workout_id, avg("avg") as avg_hr
-        FROM "workout_heart_rate"
-        WHERE time > '%s' AND time <= '%s'
-        GROUP BY workout_id`, start, stop)
+	return types, nil
+}
+
+// workoutFilter builds the WHERE clause and parameters shared by the workout
+// list and count queries
+func workoutFilter(start, stop, workoutType string) (string, influxdb3.QueryParameters) {
+	where := "time > $start AND time <= $stop"
+	params := rangeParams(start, stop)
+	if workoutType != "" {
+		where += " AND workout_name = $workout_type"
+		params["workout_type"] = workoutType
+	}
+	return where, params
+}
+
+// countWorkouts returns the number of distinct workouts matching the filter, ignoring pagination
+func (s *InfluxDBStore) countWorkouts(ctx context.Context, where string, params influxdb3.QueryParameters) (int, error) {
+	countQuery := `
+SELECT count(DISTINCT workout_id) AS total
+FROM "workout"
+WHERE ` + where
 
-	hrResult, err := s.query(context.Background(), hrQuery)
+	result, err := s.query(ctx, countQuery, params)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for result.Next() {
+		total, _ = result.Value()["total"].(int64)
+	}
+	if result.Err() != nil {
+		return 0, result.Err()
+	}
+
+	return int(total), nil
+}
+
+// GetDietaryTotals returns the day's summed calories and macros
+func (s *InfluxDBStore) GetDietaryTotals(ctx context.Context, date string) (*model.DietaryTotals, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	start, stop := getDayRangeUTC(date, s.loc)
+
+	dailyData, err := s.queryDailyNutrients(ctx, start, stop)
 	if err != nil {
 		return nil, err
 	}
 
-	for hrResult.Next() {
-		record := hrResult.Value()
-		workoutID, _ := record["workout_id"].(string)
-		avgHr, _ := record["avg_hr"].(float64)
+	totals := &model.DietaryTotals{Date: date}
+	// The range is a single local day, so there is at most one entry
+	for _, day := range dailyData {
+		totals.Calories = day.calories
+		totals.Protein = day.protein
+		totals.Carbs = day.carbs
+		totals.Fat = day.fat
+	}
+	return totals, nil
+}
 
-		if workout, ok := workoutsMap[workoutID]; ok {
-			workout.AvgHr = int(avgHr)
-			workoutsMap[workoutID] = workout
+// Calories per gram of each macro
+const (
+	proteinCaloriesPerGram = 4
+	carbsCaloriesPerGram   = 4
+	fatCaloriesPerGram     = 9
+)
+
+// GetMacroBreakdown splits the day's macro calories into protein, carbs and fat
+func (s *InfluxDBStore) GetMacroBreakdown(ctx context.Context, date string) (*model.MacroBreakdown, error) {
+	totals, err := s.GetDietaryTotals(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	return macroBreakdown(totals), nil
+}
+
+// macroBreakdown converts nutrient totals to each macro's share of calories
+func macroBreakdown(totals *model.DietaryTotals) *model.MacroBreakdown {
+	breakdown := &model.MacroBreakdown{
+		Date:    totals.Date,
+		Protein: model.MacroShare{Grams: totals.Protein, Calories: totals.Protein * proteinCaloriesPerGram},
+		Carbs:   model.MacroShare{Grams: totals.Carbs, Calories: totals.Carbs * carbsCaloriesPerGram},
+		Fat:     model.MacroShare{Grams: totals.Fat, Calories: totals.Fat * fatCaloriesPerGram},
+	}
+	breakdown.Calories = breakdown.Protein.Calories + breakdown.Carbs.Calories + breakdown.Fat.Calories
+	// Leave the percentages at zero rather than dividing by zero on an empty day
+	if breakdown.Calories > 0 {
+		for _, share := range []*model.MacroShare{&breakdown.Protein, &breakdown.Carbs, &breakdown.Fat} {
+			share.Percent = math.Round(share.Calories/breakdown.Calories*1000) / 10
 		}
 	}
-	if hrResult.Err() != nil {
-		return nil, hrResult.Err()
+	return breakdown
+}
+
+// dietaryNutrients are the measurements summed into each dailyNutrient
+var dietaryNutrients = []string{"dietary_energy", "protein", "carbohydrates", "total_fat"}
+
+// queryDailyNutrients sums each nutrient per local day over [start, stop)
+func (s *InfluxDBStore) queryDailyNutrients(ctx context.Context, start, stop string) (map[string]*dailyNutrient, error) {
+	selects := make([]string, 0, len(dietaryNutrients))
+	for _, nutrient := range dietaryNutrients {
+		selects = append(selects, fmt.Sprintf(`SELECT '%s' AS nutrient, time, qty FROM "%s" WHERE time >= $start AND time < $stop`, nutrient, nutrient))
 	}
+	sqlQuery := strings.Join(selects, "\nUNION ALL\n")
 
-	var workouts []model.Workout
-	for _, id := range workoutIDs {
-		workouts = append(workouts, workoutsMap[id])
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nutrients: %w", err)
 	}
 
-	return workouts, nil
+	dailyData := make(map[string]*dailyNutrient)
+	for result.Next() {
+		record := result.Value()
+		nutrient, _ := record["nutrient"].(string)
+		t, _ := record["time"].(time.Time)
+		value, _ := record["qty"].(float64)
+
+		dayStr := t.In(s.loc).Format("2006-01-02")
+		if _, ok := dailyData[dayStr]; !ok {
+			dailyData[dayStr] = &dailyNutrient{}
+		}
+
+		switch nutrient {
+		case "dietary_energy":
+			dailyData[dayStr].calories += value
+		case "protein":
+			dailyData[dayStr].protein += value
+		case "carbohydrates":
+			dailyData[dayStr].carbs += value
+		case "total_fat":
+			dailyData[dayStr].fat += value
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	return dailyData, nil
 }
 
 type dailyNutrient struct {
@@ -502,128 +2366,263 @@ type dailyNutrient struct {
 	fat      float64
 }
 
-func (s *InfluxDBStore) GetDietaryTrends(endDate string) ([]model.DietaryTrend, error) {
-	_, stop := getDaysRangeUTC(endDate, 30)
-	trendStart, _ := getDaysRangeUTC(endDate, 37)
-
-	nutrients := []string{"dietary_energy", "protein", "carbohydrates", "total_fat"}
-
-	// 1. Fetch all raw data points
-	dailyData := make(map[string]*dailyNutrient)
-
-	for _, nutrient := range nutrients {
-		queryRangeStart := trendStart
-
-		sqlQuery := fmt.Sprintf(`SELECT time, qty FROM "%s" WHERE time > '%s' AND time <= '%s'`, nutrient, queryRangeStart, stop)
+// averageNutrients returns the mean of each nutrient across the given days
+func averageNutrients(days []dailyNutrient) dailyNutrient {
+	var avg dailyNutrient
+	if len(days) == 0 {
+		return avg
+	}
+	for _, d := range days {
+		avg.calories += d.calories
+		avg.protein += d.protein
+		avg.carbs += d.carbs
+		avg.fat += d.fat
+	}
+	n := float64(len(days))
+	avg.calories /= n
+	avg.protein /= n
+	avg.carbs /= n
+	avg.fat /= n
+	return avg
+}
 
-		result, err := s.query(context.Background(), sqlQuery)
-		if err != nil {
-			return nil, fmt.Errorf("failed to query nutrient %s: %w", nutrient, err)
-		}
+func (s *InfluxDBStore) GetDietaryTrends(ctx context.Context, startDate, endDate string, window int) ([]model.DietaryTrend, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	endDateT, _ := time.ParseInLocation("2006-01-02", endDate, s.loc)
+	startDateT := endDateT.AddDate(0, 0, 1-s.windows.DietaryTrends)
+	if startDate != "" {
+		startDateT, _ = time.ParseInLocation("2006-01-02", startDate, s.loc)
+	}
 
-		for result.Next() {
-			record := result.Value()
-			t, _ := record["time"].(time.Time)
-			value, _ := record["qty"].(float64)
+	if window <= 0 {
+		window = model.DefaultTrendWindow
+	}
 
-			dayStr := t.In(easternZone).Format("2006-01-02")
-			if _, ok := dailyData[dayStr]; !ok {
-				dailyData[dayStr] = &dailyNutrient{}
-			}
+	// Look back an extra window so the rolling average is primed on the first day
+	leadInT := startDateT.AddDate(0, 0, -window)
+	trendStart, stop := getRangeUTC(leadInT.Format("2006-01-02"), endDate, 0, s.loc)
 
-			switch nutrient {
-			case "dietary_energy":
-				dailyData[dayStr].calories += value
-			case "protein":
-				dailyData[dayStr].protein += value
-			case "carbohydrates":
-				dailyData[dayStr].carbs += value
-			case "total_fat":
-				dailyData[dayStr].fat += value
-			}
-		}
-		if result.Err() != nil {
-			return nil, result.Err()
-		}
+	// Fetch all raw data points in a single round-trip
+	dailyData, err := s.queryDailyNutrients(ctx, trendStart, stop)
+	if err != nil {
+		return nil, err
 	}
+	return buildDietaryTrends(dailyData, startDateT, endDateT, window, tf), nil
+}
+
+// buildDietaryTrends lists each day from start to end with its intake and the
+// rolling average over the last window days of data. dailyData should reach
+// back a window before start so the average is primed on the first day.
+func buildDietaryTrends(dailyData map[string]*dailyNutrient, startDateT, endDateT time.Time, window int, tf timeFormat) []model.DietaryTrend {
+	// Require the same share of the window as the original 3-of-7 rule
+	minPoints := int(math.Ceil(float64(window) * 3 / 7))
+	leadInT := startDateT.AddDate(0, 0, -window)
 
-	// 2. Calculate rolling average for trend (matching Python's behavior)
+	// 1. Calculate rolling average for trend (matching Python's behavior)
 	var sortedDays []string
 	for dayStr := range dailyData {
 		sortedDays = append(sortedDays, dayStr)
 	}
 	sort.Strings(sortedDays)
 
-	trendValues := make(map[string]float64)
-	calorieHistory := []float64{}
-	dayHistory := []string{}
+	trendValues := make(map[string]dailyNutrient)
+	history := []dailyNutrient{}
 
 	for _, dayStr := range sortedDays {
-		calorieHistory = append(calorieHistory, dailyData[dayStr].calories)
-		dayHistory = append(dayHistory, dayStr)
-		if len(calorieHistory) > 7 {
-			calorieHistory = calorieHistory[1:]
-			dayHistory = dayHistory[1:]
+		history = append(history, *dailyData[dayStr])
+		if len(history) > window {
+			history = history[1:]
 		}
 
-		sum := 0.0
-		for _, v := range calorieHistory {
-			sum += v
-		}
-
-		if len(calorieHistory) >= 3 {
-			trendValues[dayStr] = sum / float64(len(calorieHistory))
+		if len(history) >= minPoints {
+			trendValues[dayStr] = averageNutrients(history)
 		}
 	}
 
-	// 3. Build final response with forward-fill for missing trend values (matching Python)
+	// 2. Build final response with forward-fill for missing trend values (matching Python).
+	// The fill runs from the start of the lead-in so a displayed window that
+	// opens on a day without data carries the lead-in's trend instead of 0.
 	var trends []model.DietaryTrend
-	var lastTrend float64 = 0
-
-	endDateT, _ := time.ParseInLocation("2006-01-02", endDate, easternZone)
-	startDateT := endDateT.AddDate(0, 0, -29)
+	var lastTrend dailyNutrient
 
-	for d := startDateT; !d.After(endDateT); d = d.AddDate(0, 0, 1) {
+	for d := leadInT; !d.After(endDateT); d = d.AddDate(0, 0, 1) {
 		dayStr := d.Format("2006-01-02")
 
+		// Forward-fill trend values (matching Python's fill_null(strategy='forward'))
+		if trend, ok := trendValues[dayStr]; ok {
+			lastTrend = trend
+		}
+		if d.Before(startDateT) {
+			continue
+		}
+
 		data := &dailyNutrient{}
 		if val, ok := dailyData[dayStr]; ok {
 			data = val
 		}
 
-		// Forward-fill trend values (matching Python's fill_null(strategy='forward'))
-		if trend, ok := trendValues[dayStr]; ok {
-			lastTrend = trend
+		trends = append(trends, model.DietaryTrend{
+			Date:         tf.day(d, "Jan 02"),
+			Calories:     data.calories,
+			Protein:      data.protein,
+			Carbs:        data.carbs,
+			Fat:          data.fat,
+			Trend:        lastTrend.calories,
+			ProteinTrend: lastTrend.protein,
+			CarbsTrend:   lastTrend.carbs,
+			FatTrend:     lastTrend.fat,
+		})
+	}
+
+	return trends
+}
+
+func (s *InfluxDBStore) GetDietaryMealsToday(ctx context.Context, date string) ([]model.Meal, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	start, stop := getDayRangeUTC(date, s.loc)
+
+	// Until an entry carrying a meal tag is written the column doesn't exist
+	// and the query below would fail, so check the schema first.
+	tags, err := s.tagKeys(ctx, "dietary_energy")
+	if errors.Is(err, model.ErrNotFound) || (err == nil && !slices.Contains(tags, "meal")) {
+		return []model.Meal{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Per-entry dietary energy records are tagged with the meal they belong to
+	sqlQuery := `
+SELECT meal, sum(qty) as calories, count(qty) as entries, min(time) as first_time
+FROM "dietary_energy"
+WHERE time >= $start AND time < $stop AND meal IS NOT NULL
+GROUP BY meal
+ORDER BY first_time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	meals := []model.Meal{}
+	for result.Next() {
+		record := result.Value()
+		name, okName := record["meal"].(string)
+		if !okName || name == "" {
+			continue
 		}
 
-		trends = append(trends, model.DietaryTrend{
-			Date:     d.Format("Jan 02"),
-			Calories: data.calories,
-			Protein:  data.protein,
-			Carbs:    data.carbs,
-			Fat:      data.fat,
-			Trend:    lastTrend,
+		var calories float64
+		switch v := record["calories"].(type) {
+		case float64:
+			calories = v
+		case int64:
+			calories = float64(v)
+		default:
+			continue
+		}
+
+		entries, _ := record["entries"].(int64)
+		desc := fmt.Sprintf("%d entries", entries)
+		if entries == 1 {
+			desc = "1 entry"
+		}
+
+		meals = append(meals, model.Meal{
+			Name: name,
+			Desc: desc,
+			Cal:  int(math.Round(calories)),
 		})
 	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
 
-	return trends, nil
+	return meals, nil
 }
 
-func (s *InfluxDBStore) GetDietaryMealsToday(date string) ([]model.Meal, error) {
-	// The schema does not clearly support this query. Returning placeholder data.
-	return []model.Meal{
-		{Name: "Breakfast", Desc: "Oatmeal, Berries, Whey", Cal: 420},
-		{Name: "Lunch", Desc: "Chicken Salad, Quinoa", Cal: 580},
-	}, nil
+// glucoseStats computes the average, population standard deviation, GMI and
+// time in/below/above target. Readings are treated as evenly spaced, which
+// holds for CGM data.
+func glucoseStats(glucoses []model.Glucose, target model.GlucoseRange) *model.GlucoseStats {
+	stats := &model.GlucoseStats{Readings: len(glucoses), Range: target}
+	if len(glucoses) == 0 {
+		return stats
+	}
+
+	var sum float64
+	var below, in, above int
+	for _, g := range glucoses {
+		sum += g.Value
+		switch {
+		case g.Value < target.Low:
+			below++
+		case g.Value > target.High:
+			above++
+		default:
+			in++
+		}
+	}
+	n := float64(len(glucoses))
+	mean := sum / n
+
+	var squares float64
+	for _, g := range glucoses {
+		squares += (g.Value - mean) * (g.Value - mean)
+	}
+	stdDev := math.Sqrt(squares / n)
+
+	// Glucose Management Indicator (Bergenstal et al., 2018), for mg/dL
+	gmi := 3.31 + 0.02392*mean
+
+	inPct := float64(in) / n * 100
+	belowPct := float64(below) / n * 100
+	abovePct := float64(above) / n * 100
+
+	stats.Average = &mean
+	stats.StdDev = &stdDev
+	stats.GMI = &gmi
+	stats.TimeInRange = &inPct
+	stats.TimeBelowRange = &belowPct
+	stats.TimeAboveRange = &abovePct
+	return stats
+}
+
+type weightReading struct {
+	t      time.Time
+	weight float64
 }
 
-func (s *InfluxDBStore) GetBodyComposition(endDate string) ([]model.BodyComposition, error) {
-	start, stop := getDaysRangeUTC(endDate, 30)
+// closestWeight returns the reading nearest in time to t, if any
+func closestWeight(readings []weightReading, t time.Time) (float64, bool) {
+	var best weightReading
+	var bestDiff time.Duration = -1
+	for _, r := range readings {
+		diff := r.t.Sub(t)
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best = r
+			bestDiff = diff
+		}
+	}
+	return best.weight, bestDiff >= 0
+}
 
-	// 1. Fetch weight data into a map keyed by timestamp
-	weightMap := make(map[time.Time]float64)
-	weightQuery := fmt.Sprintf(`SELECT time, qty as weight FROM "weight_body_mass" WHERE time > '%s' AND time <= '%s'`, start, stop)
-	weightResult, err := s.query(context.Background(), weightQuery)
+func (s *InfluxDBStore) GetBodyComposition(ctx context.Context, startDate, endDate string) ([]model.BodyComposition, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.BodyComposition, s.loc)
+
+	// 1. Fetch weight data grouped by local calendar day
+	weightsByDay := make(map[string][]weightReading)
+	weightQuery := `SELECT time, qty as weight FROM "weight_body_mass" WHERE time > $start AND time <= $stop`
+	weightResult, err := s.query(ctx, weightQuery, rangeParams(start, stop))
 	if err != nil {
 		return nil, fmt.Errorf("weight query error: %w", err)
 	}
@@ -633,19 +2632,20 @@ func (s *InfluxDBStore) GetBodyComposition(endDate string) ([]model.BodyComposit
 		t, okTime := record["time"].(time.Time)
 		weight, okWeight := record["weight"].(float64)
 		if okTime && okWeight {
-			weightMap[t] = weight
+			dayStr := t.In(s.loc).Format("2006-01-02")
+			weightsByDay[dayStr] = append(weightsByDay[dayStr], weightReading{t: t, weight: weight})
 		}
 	}
 	if weightResult.Err() != nil {
 		return nil, weightResult.Err()
 	}
 
-	// log.Printf("Found %d weight records", len(weightMap))
+	slog.DebugContext(ctx, "found weight days", slog.Int("count", len(weightsByDay)))
 
 	// 2. Fetch body fat data and perform an inner join with weight data
 	var compositions []model.BodyComposition
-	bfQuery := fmt.Sprintf(`SELECT time, qty as bodyFat FROM "body_fat_percentage" WHERE time > '%s' AND time <= '%s'`, start, stop)
-	bfResult, err := s.query(context.Background(), bfQuery)
+	bfQuery := `SELECT time, qty as bodyFat FROM "body_fat_percentage" WHERE time > $start AND time <= $stop`
+	bfResult, err := s.query(ctx, bfQuery, rangeParams(start, stop))
 	if err != nil {
 		return nil, fmt.Errorf("body fat query error: %w", err)
 	}
@@ -655,12 +2655,14 @@ func (s *InfluxDBStore) GetBodyComposition(endDate string) ([]model.BodyComposit
 		t, okTime := record["time"].(time.Time)
 		bodyFat, okBF := record["bodyfat"].(float64)
 
-		// Check for matching weight measurement at the same timestamp (inner join)
+		// Join to the closest weight measurement on the same day; scales rarely
+		// stamp weight and body fat with the exact same time
 		if okTime && okBF {
-			if weight, ok := weightMap[t]; ok {
+			dayStr := t.In(s.loc).Format("2006-01-02")
+			if weight, ok := closestWeight(weightsByDay[dayStr], t); ok {
 				compositions = append(compositions, model.BodyComposition{
 					T:       t,
-					Time:    t.In(easternZone).Format("Jan 02"),
+					Time:    tf.instant(t, "Jan 02"),
 					Weight:  weight,
 					BodyFat: bodyFat,
 				})
@@ -673,75 +2675,366 @@ func (s *InfluxDBStore) GetBodyComposition(endDate string) ([]model.BodyComposit
 		return nil, bfResult.Err()
 	}
 
-	// log.Printf("Found %d composition records", len(compositions))
+	slog.DebugContext(ctx, "found composition records", slog.Int("count", len(compositions)))
 
 	// Sort results by time ascending
 	sort.Slice(compositions, func(i, j int) bool {
 		return compositions[i].T.Before(compositions[j].T)
 	})
 
-	// for _, value := range compositions {
-	// 	t := value.T.Format(time.RFC3339)
-	// 	w := value.Weight
-	// 	b := value.BodyFat
-	// 	log.Printf("comp records: time = %s, weight= %f, bf= %f\n", t, w, b)
-	// }
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		for _, value := range compositions {
+			slog.DebugContext(ctx, "composition record",
+				slog.Time("time", value.T),
+				slog.Float64("weight", value.Weight),
+				slog.Float64("body_fat", value.BodyFat),
+			)
+		}
+	}
+
+	addWeightTrend(compositions)
 
 	return compositions, nil
 }
 
+const (
+	weightTrendDays = 7
+	// flatWeightSlope is the kg/day change below which weight counts as flat
+	// (about 0.1 kg a week)
+	flatWeightSlope = 0.015
+)
+
+// addWeightTrend fills TrendWeight on time-ordered rows, and the window-wide
+// Direction and WeightStdDev on every row. Weigh-ins are irregular, so the
+// smoothing factor scales with the gap since the last reading rather than
+// assuming one reading per day.
+func addWeightTrend(compositions []model.BodyComposition) {
+	window := weightTrendDays * 24 * time.Hour
+	for i := range compositions {
+		c := &compositions[i]
+		if i == 0 {
+			c.TrendWeight = c.Weight
+			continue
+		}
+		prev := compositions[i-1]
+		alpha := 1 - math.Exp(-c.T.Sub(prev.T).Hours()/window.Hours())
+		c.TrendWeight = prev.TrendWeight + alpha*(c.Weight-prev.TrendWeight)
+	}
+
+	direction := ""
+	if slope, ok := weightSlope(compositions); ok {
+		switch {
+		case slope > flatWeightSlope:
+			direction = "up"
+		case slope < -flatWeightSlope:
+			direction = "down"
+		default:
+			direction = "flat"
+		}
+	}
+	stdDev := weightStdDev(compositions)
+	for i := range compositions {
+		compositions[i].Direction = direction
+		compositions[i].WeightStdDev = stdDev
+	}
+}
+
+// weightStdDev returns the population standard deviation of weight, rounded
+// to two decimals
+func weightStdDev(rows []model.BodyComposition) float64 {
+	if len(rows) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, r := range rows {
+		sum += r.Weight
+	}
+	mean := sum / float64(len(rows))
+	var squares float64
+	for _, r := range rows {
+		squares += (r.Weight - mean) * (r.Weight - mean)
+	}
+	return math.Round(math.Sqrt(squares/float64(len(rows)))*100) / 100
+}
+
+// weightSlope returns the least-squares slope of weight in kg/day
+func weightSlope(rows []model.BodyComposition) (float64, bool) {
+	if len(rows) < 2 {
+		return 0, false
+	}
+	n := float64(len(rows))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, r := range rows {
+		x := r.T.Sub(rows[0].T).Hours() / 24
+		sumX += x
+		sumY += r.Weight
+		sumXY += x * r.Weight
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denom, true
+}
+
+func (s *InfluxDBStore) GetWeight(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	start, stop := getRangeUTC(startDate, endDate, s.windows.Weight, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "weight_body_mass"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, fmt.Errorf("weight query error: %w", err)
+	}
+
+	var weights []model.TimeSeriesValue
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			weights = append(weights, model.TimeSeriesValue{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return weights, nil
+}
+
+func (s *InfluxDBStore) GetBodyFat(ctx context.Context, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+
+	start, stop := getRangeUTC(startDate, endDate, s.windows.BodyFat, s.loc)
+	sqlQuery := `
+SELECT time, qty as value
+FROM "body_fat_percentage"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, fmt.Errorf("body fat query error: %w", err)
+	}
+
+	var bodyFat []model.TimeSeriesValue
+	for result.Next() {
+		record := result.Value()
+		value, okVal := record["value"].(float64)
+		t, okTime := record["time"].(time.Time)
+		if okVal && okTime {
+			bodyFat = append(bodyFat, model.TimeSeriesValue{
+				Time:  tf.instant(t, "Jan 02"),
+				Value: value,
+			})
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return bodyFat, nil
+}
+
 // --- Helper Functions ---
 
-// getDayRangeUTC returns UTC timestamps for the start and end of a day in Eastern time
-func getDayRangeUTC(dateStr string) (string, string) {
-	// Parse date in Eastern timezone
-	t, _ := time.ParseInLocation("2006-01-02", dateStr, easternZone)
+// getDayRangeUTC returns UTC timestamps for the start and end of a day in the given location
+func getDayRangeUTC(dateStr string, loc *time.Location) (string, string) {
+	// Parse date in local timezone
+	t, _ := time.ParseInLocation("2006-01-02", dateStr, loc)
 
-	// Create start and end times in Eastern
-	startEastern := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, easternZone)
-	endEastern := startEastern.Add(24 * time.Hour)
+	// Create start and end times in local time
+	startLocal := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	endLocal := startLocal.AddDate(0, 0, 1)
 
 	// Convert to UTC for InfluxDB query
-	startUTC := startEastern.UTC().Format(time.RFC3339)
-	endUTC := endEastern.UTC().Format(time.RFC3339)
+	startUTC := startLocal.UTC().Format(time.RFC3339)
+	endUTC := endLocal.UTC().Format(time.RFC3339)
 
 	return startUTC, endUTC
 }
 
-// getDaysRangeUTC returns UTC timestamps for a range of days ending on endDate
-func getDaysRangeUTC(endDateStr string, days int) (string, string) {
-	// Parse end date in Eastern timezone
-	endDate, _ := time.ParseInLocation("2006-01-02", endDateStr, easternZone)
+// hrWindowUTC returns the UTC bounds of the heart rate chart for date. Past
+// days cover that local calendar day. Today keeps the rolling 24-hour window
+// ending at now so the chart isn't empty just after midnight; the handler's UTC
+// default can run a day ahead of local time, so later dates count as today.
+func hrWindowUTC(date string, now time.Time, loc *time.Location) (string, string) {
+	if date != "" && date < now.In(loc).Format("2006-01-02") {
+		return getDayRangeUTC(date, loc)
+	}
+	now = now.UTC()
+	return now.Add(-24 * time.Hour).Format(time.RFC3339), now.Format(time.RFC3339)
+}
+
+// getNightRangeUTC returns the UTC bounds of the night ending on dateStr, from
+// nightCutoffHour the previous day to nightCutoffHour on dateStr
+func getNightRangeUTC(dateStr string, loc *time.Location) (string, string) {
+	t, _ := time.ParseInLocation("2006-01-02", dateStr, loc)
+	stopLocal := time.Date(t.Year(), t.Month(), t.Day(), nightCutoffHour, 0, 0, 0, loc)
+	startLocal := stopLocal.AddDate(0, 0, -1)
+	return startLocal.UTC().Format(time.RFC3339), stopLocal.UTC().Format(time.RFC3339)
+}
+
+// getDaysRangeUTC returns UTC timestamps for a range of days ending on endDate in the given location
+func getDaysRangeUTC(endDateStr string, days int, loc *time.Location) (string, string) {
+	// Parse end date in local timezone
+	endDate, _ := time.ParseInLocation("2006-01-02", endDateStr, loc)
 
-	// Create end of day in Eastern
-	endEastern := time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 23, 59, 59, 999999999, easternZone)
+	// Create end of day in local time
+	endLocal := time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 23, 59, 59, 999999999, loc)
 
 	// Calculate start date
 	startDate := endDate.AddDate(0, 0, -days+1)
-	startEastern := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, easternZone)
+	startLocal := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, loc)
 
 	// Convert to UTC for InfluxDB query
-	startUTC := startEastern.UTC().Format(time.RFC3339)
-	stopUTC := endEastern.UTC().Format(time.RFC3339)
+	startUTC := startLocal.UTC().Format(time.RFC3339)
+	stopUTC := endLocal.UTC().Format(time.RFC3339)
 
 	return startUTC, stopUTC
 }
 
-func getBPCategory(systolic, diastolic int) string {
-	if systolic > 180 || diastolic > 120 {
-		return "Hypertensive Crisis"
+// sleepEfficiency returns the share of the night spent asleep as a percentage
+// rounded to one decimal, or 0 when no sleep was recorded
+func sleepEfficiency(totalSleep, awake float64) float64 {
+	if totalSleep <= 0 {
+		return 0
 	}
-	if systolic >= 140 || diastolic >= 90 {
-		return "Hypertension Stage 2"
+	efficiency := (totalSleep - awake) / totalSleep * 100
+	return math.Round(efficiency*10) / 10
+}
+
+// averageSleep groups nights (with their local times) into week or month
+// buckets and averages each over the nights actually recorded in it
+func averageSleep(nights []model.Sleep, times []time.Time, interval model.Interval, tf timeFormat) []model.Sleep {
+	var buckets []model.Sleep
+	var bucketStart time.Time
+	for i, night := range nights {
+		t := times[i]
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		label := "Jan 02"
+		if interval == model.IntervalMonth {
+			start = start.AddDate(0, 0, 1-start.Day())
+			label = "Jan 2006"
+		} else {
+			// Weekday is 0 on Sunday; step back to Monday
+			start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		}
+
+		// Nights arrive in time order, so a new bucket start means a new bucket
+		if len(buckets) == 0 || !start.Equal(bucketStart) {
+			bucketStart = start
+			buckets = append(buckets, model.Sleep{Date: tf.day(start, label)})
+		}
+		bucket := &buckets[len(buckets)-1]
+		bucket.TotalDuration += night.TotalDuration
+		bucket.DeepSleep += night.DeepSleep
+		bucket.RemSleep += night.RemSleep
+		bucket.LightSleep += night.LightSleep
+		bucket.Awake += night.Awake
+		bucket.Nights++
 	}
-	if (systolic >= 130 && systolic <= 139) || (diastolic >= 80 && diastolic <= 89) {
-		return "Hypertension Stage 1"
+
+	for i := range buckets {
+		bucket := &buckets[i]
+		n := float64(bucket.Nights)
+		bucket.TotalDuration /= n
+		bucket.DeepSleep /= n
+		bucket.RemSleep /= n
+		bucket.LightSleep /= n
+		bucket.Awake /= n
+		bucket.Efficiency = sleepEfficiency(bucket.TotalDuration, bucket.Awake)
+	}
+	return buckets
+}
+
+// getRangeUTC returns UTC timestamps covering startDate through endDate in the given
+// location, falling back to a window of defaultDays ending on endDate when startDate is empty
+func getRangeUTC(startDateStr, endDateStr string, defaultDays int, loc *time.Location) (string, string) {
+	if startDateStr == "" {
+		return getDaysRangeUTC(endDateStr, defaultDays, loc)
+	}
+
+	startUTC, _ := getDayRangeUTC(startDateStr, loc)
+	_, stopUTC := getDaysRangeUTC(endDateStr, 1, loc)
+
+	return startUTC, stopUTC
+}
+
+// getBPCategory categorizes a reading under standard, defaulting to ACC/AHA
+func getBPCategory(standard model.BPStandard, systolic, diastolic int) string {
+	switch standard {
+	case model.BPStandardESC:
+		return escBPCategory(systolic, diastolic)
+	case model.BPStandardJNC7:
+		return jnc7BPCategory(systolic, diastolic)
+	default:
+		return accAHABPCategory(systolic, diastolic)
 	}
-	if systolic >= 120 && systolic <= 129 && diastolic < 80 {
+}
+
+// accAHABPCategory uses the ACC/AHA 2017 categories. Each case only needs the
+// lower bound because higher readings were caught above, so every reading gets
+// a category; e.g. 125/85 is Stage 1 on its diastolic value.
+func accAHABPCategory(systolic, diastolic int) string {
+	switch {
+	case systolic > 180 || diastolic > 120:
+		return "Hypertensive Crisis"
+	case systolic >= 140 || diastolic >= 90:
+		return "Hypertension Stage 2"
+	case systolic >= 130 || diastolic >= 80:
+		return "Hypertension Stage 1"
+	case systolic >= 120:
 		return "Elevated"
+	default:
+		return "Normal"
 	}
-	if systolic < 120 && diastolic < 80 {
+}
+
+// escBPCategory uses the ESC/ESH 2018 grades; when systolic and diastolic
+// fall in different grades the higher one applies
+func escBPCategory(systolic, diastolic int) string {
+	switch {
+	case systolic >= 180 || diastolic >= 110:
+		return "Grade 3 Hypertension"
+	case systolic >= 160 || diastolic >= 100:
+		return "Grade 2 Hypertension"
+	case systolic >= 140 || diastolic >= 90:
+		return "Grade 1 Hypertension"
+	case systolic >= 130 || diastolic >= 85:
+		return "High Normal"
+	case systolic >= 120 || diastolic >= 80:
+		return "Normal"
+	default:
+		return "Optimal"
+	}
+}
+
+// jnc7BPCategory uses the JNC7 (2003) classification
+func jnc7BPCategory(systolic, diastolic int) string {
+	switch {
+	case systolic >= 160 || diastolic >= 100:
+		return "Hypertension Stage 2"
+	case systolic >= 140 || diastolic >= 90:
+		return "Hypertension Stage 1"
+	case systolic >= 120 || diastolic >= 80:
+		return "Prehypertension"
+	default:
 		return "Normal"
 	}
-	return "Unknown"
 }
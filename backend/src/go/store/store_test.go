@@ -0,0 +1,766 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+
+	"health_app/api/model"
+)
+
+// encodeMetric encodes m as line protocol the way Ingest does and decodes the
+// line back into a metric, so tests can compare what InfluxDB would receive
+func encodeMetric(t *testing.T, m model.Metric) model.Metric {
+	t.Helper()
+	point, errs := metricToPoint(m)
+	if len(errs) > 0 {
+		t.Fatalf("metricToPoint: %v", errs)
+	}
+	line, err := point.MarshalBinary(lineprotocol.Nanosecond)
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return decodeLine(t, line, lineprotocol.Nanosecond)
+}
+
+// decodeLine parses a single line of line protocol into a metric. A line
+// without a timestamp decodes with a zero Timestamp.
+func decodeLine(t *testing.T, line []byte, precision lineprotocol.Precision) model.Metric {
+	t.Helper()
+	dec := lineprotocol.NewDecoderWithBytes(line)
+	if !dec.Next() {
+		t.Fatalf("no line in %q", line)
+	}
+	measurement, err := dec.Measurement()
+	if err != nil {
+		t.Fatalf("decoding %q: %v", line, err)
+	}
+	decoded := model.Metric{
+		Measurement: string(measurement),
+		Tags:        make(map[string]string),
+		Fields:      make(map[string]interface{}),
+	}
+	for {
+		key, value, err := dec.NextTag()
+		if err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		if key == nil {
+			break
+		}
+		decoded.Tags[string(key)] = string(value)
+	}
+	for {
+		key, value, err := dec.NextField()
+		if err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		if key == nil {
+			break
+		}
+		decoded.Fields[string(key)] = value.Interface()
+	}
+	timestamp, err := dec.TimeBytes()
+	if err != nil {
+		t.Fatalf("decoding %q: %v", line, err)
+	}
+	if timestamp != nil {
+		n, err := strconv.ParseInt(string(timestamp), 10, 64)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		decoded.Timestamp = time.Unix(0, n*int64(precision.Duration())).UTC()
+	}
+	if dec.Next() {
+		t.Fatalf("%q encoded more than one line", line)
+	}
+	return decoded
+}
+
+func TestMetricToPointEscaping(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		metric model.Metric
+	}{
+		{
+			name: "commas",
+			metric: model.Metric{
+				Measurement: "blood,pressure",
+				Tags:        map[string]string{"source,app": "Health, iPhone"},
+				Fields:      map[string]interface{}{"sys,dia": "120,80"},
+			},
+		},
+		{
+			name: "spaces",
+			metric: model.Metric{
+				Measurement: "heart rate",
+				Tags:        map[string]string{"device name": "Apple Watch"},
+				Fields:      map[string]interface{}{"resting value": 58.0},
+			},
+		},
+		{
+			name: "equals",
+			metric: model.Metric{
+				Measurement: "ratio=1",
+				Tags:        map[string]string{"a=b": "c=d"},
+				Fields:      map[string]interface{}{"x=y": 1.5},
+			},
+		},
+		{
+			name: "quotes and backslashes",
+			metric: model.Metric{
+				Measurement: `meal\log`,
+				Tags:        map[string]string{"note": `say "hi" \ there`},
+				Fields:      map[string]interface{}{"name": `Mom's "famous" \ pie`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.metric.Timestamp = ts
+			got := encodeMetric(t, tt.metric)
+			if got.Measurement != tt.metric.Measurement {
+				t.Errorf("measurement = %q, want %q", got.Measurement, tt.metric.Measurement)
+			}
+			if !maps.Equal(got.Tags, tt.metric.Tags) {
+				t.Errorf("tags = %q, want %q", got.Tags, tt.metric.Tags)
+			}
+			if !maps.Equal(got.Fields, tt.metric.Fields) {
+				t.Errorf("fields = %v, want %v", got.Fields, tt.metric.Fields)
+			}
+			if !got.Timestamp.Equal(ts) {
+				t.Errorf("timestamp = %v, want %v", got.Timestamp, ts)
+			}
+		})
+	}
+}
+
+func TestBuildPointsSkipsUnencodableTag(t *testing.T) {
+	// A trailing backslash in a tag value has no line protocol escape
+	metrics := []model.Metric{
+		{Measurement: "meal", Tags: map[string]string{"note": `C:\`}, Fields: map[string]interface{}{"value": 1.0}},
+		{Measurement: "meal", Tags: map[string]string{"note": "fine"}, Fields: map[string]interface{}{"value": 2.0}},
+	}
+	points, result := buildPoints(metrics, lineprotocol.Nanosecond)
+	if len(points) != 1 || result.Written != 1 || result.Skipped != 1 {
+		t.Errorf("wrote %d and skipped %d, want 1 and 1", result.Written, result.Skipped)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("errors = %q, want one for metric 0", result.Errors)
+	}
+}
+
+func TestSleepEfficiency(t *testing.T) {
+	tests := []struct {
+		name              string
+		totalSleep, awake float64
+		want              float64
+	}{
+		{name: "no awake time", totalSleep: 8, awake: 0, want: 100},
+		{name: "half hour awake", totalSleep: 8, awake: 0.5, want: 93.8},
+		{name: "rounds to one decimal", totalSleep: 7, awake: 1, want: 85.7},
+		{name: "mostly awake", totalSleep: 4, awake: 3, want: 25},
+		{name: "no sleep recorded", totalSleep: 0, awake: 0.5, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sleepEfficiency(tt.totalSleep, tt.awake); got != tt.want {
+				t.Errorf("sleepEfficiency(%v, %v) = %v, want %v", tt.totalSleep, tt.awake, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClosestWeight(t *testing.T) {
+	morning := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		readings []weightReading
+		bodyFat  time.Time
+		want     float64
+		wantOK   bool
+	}{
+		{
+			name:     "body fat 2s after weight",
+			readings: []weightReading{{t: morning, weight: 80.2}},
+			bodyFat:  morning.Add(2 * time.Second),
+			want:     80.2,
+			wantOK:   true,
+		},
+		{
+			name:     "body fat 2s before weight",
+			readings: []weightReading{{t: morning, weight: 80.2}},
+			bodyFat:  morning.Add(-2 * time.Second),
+			want:     80.2,
+			wantOK:   true,
+		},
+		{
+			name: "picks the nearer of two weighings",
+			readings: []weightReading{
+				{t: morning, weight: 80.2},
+				{t: morning.Add(12 * time.Hour), weight: 81.0},
+			},
+			bodyFat: morning.Add(12*time.Hour + 2*time.Second),
+			want:    81.0,
+			wantOK:  true,
+		},
+		{
+			name:    "no weight that day",
+			bodyFat: morning,
+			wantOK:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := closestWeight(tt.readings, tt.bodyFat)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("closestWeight = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCollectWorkoutsDedupes(t *testing.T) {
+	start := time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+	records := []map[string]interface{}{
+		{"workout_id": "run-1", "start_time": start, "workout_name": "Running", "duration": int64(1800), "active_energy_value": int64(300)},
+		{"workout_id": "run-1", "start_time": start.Add(time.Minute), "workout_name": "Running", "duration": int64(1800), "active_energy_value": int64(300)},
+		{"workout_id": "ride-1", "start_time": start.Add(3 * time.Hour), "workout_name": "Cycling", "duration": int64(3600), "active_energy_value": int64(500)},
+	}
+	s := &InfluxDBStore{}
+	workouts, ids := s.collectWorkouts(records, timeFormat{loc: time.UTC})
+
+	if want := []string{"run-1", "ride-1"}; !slices.Equal(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	run := workouts["run-1"]
+	if run.Time != "2024-03-05 07:00" || run.Duration != 30 || run.Calories != 300 {
+		t.Errorf("run-1 = %+v, want the first row's 07:00 start, 30 min and 300 kcal", run)
+	}
+}
+
+func TestRetryWrite(t *testing.T) {
+	unavailable := &influxdb3.ServerError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	rejected := &influxdb3.ServerError{StatusCode: http.StatusBadRequest, Message: "bad line protocol"}
+	tests := []struct {
+		name      string
+		failures  []error // Returned by successive calls, then success
+		attempts  int
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "fails twice then succeeds", failures: []error{unavailable, unavailable}, attempts: 3, wantCalls: 3},
+		{name: "succeeds first time", attempts: 3, wantCalls: 1},
+		{name: "out of attempts", failures: []error{unavailable, unavailable, unavailable}, attempts: 3, wantCalls: 3, wantErr: unavailable},
+		{name: "permanent error isn't retried", failures: []error{rejected}, attempts: 3, wantCalls: 1, wantErr: rejected},
+		{name: "throttled", failures: []error{&influxdb3.ServerError{StatusCode: http.StatusTooManyRequests}}, attempts: 2, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryWrite(context.Background(), tt.attempts, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("write called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryWriteStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := retryWrite(ctx, 5, time.Hour, func() error {
+		calls++
+		cancel()
+		return &influxdb3.ServerError{StatusCode: http.StatusBadGateway}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("got %v after %d calls, want the first error without waiting out the backoff", err, calls)
+	}
+}
+
+func TestMetricToPointFieldTypes(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		fieldTypes map[string]model.FieldType
+		want       interface{}
+	}{
+		{name: "no hint writes a float", value: 8421.0, want: 8421.0},
+		{name: "integer hint", value: 8421.0, fieldTypes: map[string]model.FieldType{"value": model.FieldTypeInteger}, want: int64(8421)},
+		{name: "float hint", value: 72.0, fieldTypes: map[string]model.FieldType{"value": model.FieldTypeFloat}, want: 72.0},
+		{name: "fractional float", value: 72.5, want: 72.5},
+		{name: "hint for another field", value: 72.5, fieldTypes: map[string]model.FieldType{"count": model.FieldTypeInteger}, want: 72.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeMetric(t, model.Metric{
+				Measurement: "step_count",
+				Fields:      map[string]interface{}{"value": tt.value},
+				FieldTypes:  tt.fieldTypes,
+			})
+			if got.Fields["value"] != tt.want {
+				t.Errorf("value = %#v, want %#v", got.Fields["value"], tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeToUser(t *testing.T) {
+	userTables := map[string]bool{"heart_rate": true, "step_count": true}
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "tagged table",
+			query: `SELECT time, qty FROM "heart_rate" WHERE time > $start`,
+			want:  `SELECT time, qty FROM (SELECT * FROM "heart_rate" WHERE user_id = $user_id) AS "heart_rate" WHERE time > $start`,
+		},
+		{
+			name:  "legacy table without user_id reads as empty",
+			query: `SELECT qty FROM "weight_body_mass"`,
+			want:  `SELECT qty FROM (SELECT * FROM "weight_body_mass" WHERE false) AS "weight_body_mass"`,
+		},
+		{
+			name:  "every table in a union",
+			query: "SELECT qty FROM \"step_count\"\nUNION ALL\nSELECT qty FROM \"weight_body_mass\"",
+			want:  "SELECT qty FROM (SELECT * FROM \"step_count\" WHERE user_id = $user_id) AS \"step_count\"\nUNION ALL\nSELECT qty FROM (SELECT * FROM \"weight_body_mass\" WHERE false) AS \"weight_body_mass\"",
+		},
+		{
+			name:  "information_schema is untouched",
+			query: `SELECT table_name FROM information_schema.tables`,
+			want:  `SELECT table_name FROM information_schema.tables`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeToUser(tt.query, userTables); got != tt.want {
+				t.Errorf("scopeToUser =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHRWindowUTC(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable:", err)
+	}
+	// 01:00 UTC on Mar 6 is still the evening of Mar 5 in New York
+	now := time.Date(2024, 3, 6, 1, 0, 0, 0, time.UTC)
+	rolling := [2]string{"2024-03-05T01:00:00Z", "2024-03-06T01:00:00Z"}
+	tests := []struct {
+		name string
+		date string
+		want [2]string
+	}{
+		{name: "past date covers that local day", date: "2024-03-01", want: [2]string{"2024-03-01T05:00:00Z", "2024-03-02T05:00:00Z"}},
+		{name: "yesterday", date: "2024-03-04", want: [2]string{"2024-03-04T05:00:00Z", "2024-03-05T05:00:00Z"}},
+		{name: "local today is rolling", date: "2024-03-05", want: rolling},
+		{name: "UTC today is rolling", date: "2024-03-06", want: rolling},
+		{name: "no date is rolling", date: "", want: rolling},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, stop := hrWindowUTC(tt.date, now, newYork)
+			if got := [2]string{start, stop}; got != tt.want {
+				t.Errorf("hrWindowUTC(%q) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddWeightTrend(t *testing.T) {
+	day := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	weighIns := func(weights ...float64) []model.BodyComposition {
+		rows := make([]model.BodyComposition, len(weights))
+		for i, w := range weights {
+			rows[i] = model.BodyComposition{T: day.AddDate(0, 0, i), Weight: w}
+		}
+		return rows
+	}
+	tests := []struct {
+		name          string
+		rows          []model.BodyComposition
+		wantDirection string
+		wantStdDev    float64
+	}{
+		{name: "losing", rows: weighIns(82, 81.5, 81, 80.5), wantDirection: "down", wantStdDev: 0.56},
+		{name: "gaining", rows: weighIns(80, 80.2, 80.4, 80.6), wantDirection: "up", wantStdDev: 0.22},
+		{name: "noise around a level weight", rows: weighIns(80, 80.1, 80.1, 80), wantDirection: "flat", wantStdDev: 0.05},
+		{name: "one reading has no direction", rows: weighIns(80), wantStdDev: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addWeightTrend(tt.rows)
+			if tt.rows[0].TrendWeight != tt.rows[0].Weight {
+				t.Errorf("first trend weight = %v, want the first reading %v", tt.rows[0].TrendWeight, tt.rows[0].Weight)
+			}
+			for i, row := range tt.rows {
+				if row.Direction != tt.wantDirection || row.WeightStdDev != tt.wantStdDev {
+					t.Errorf("row %d direction %q stddev %v, want %q and %v on every row", i, row.Direction, row.WeightStdDev, tt.wantDirection, tt.wantStdDev)
+				}
+			}
+		})
+	}
+}
+
+func TestCapBuckets(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    time.Duration
+		bucket    time.Duration
+		maxPoints int
+		want      time.Duration
+	}{
+		{name: "already under the cap", window: 24 * time.Hour, bucket: 30 * time.Minute, maxPoints: 100, want: 30 * time.Minute},
+		{name: "widens to the next step", window: 24 * time.Hour, bucket: 10 * time.Minute, maxPoints: 100, want: 15 * time.Minute},
+		{name: "exact fit", window: 24 * time.Hour, bucket: time.Minute, maxPoints: 25, want: time.Hour},
+		{name: "one point", window: 24 * time.Hour, bucket: 10 * time.Minute, maxPoints: 1, want: 24 * time.Hour},
+		{name: "beyond the largest step", window: 30*time.Hour + 30*time.Minute, bucket: 10 * time.Minute, maxPoints: 1, want: 31 * time.Hour},
+		{name: "empty window", window: 0, bucket: 10 * time.Minute, maxPoints: 5, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := capBuckets(tt.window, tt.bucket, tt.maxPoints)
+			if got != tt.want {
+				t.Fatalf("capBuckets = %s, want %s", got, tt.want)
+			}
+			// A clock-aligned window can straddle one bucket more than it spans
+			spanned := int((tt.window + got - 1) / got)
+			if tt.maxPoints > 1 && spanned+1 > tt.maxPoints {
+				t.Errorf("%s buckets can yield %d points, over the cap of %d", got, spanned+1, tt.maxPoints)
+			}
+		})
+	}
+}
+
+func TestGetBPCategoryBoundaries(t *testing.T) {
+	tests := []struct {
+		standard            model.BPStandard
+		systolic, diastolic int
+		want                string
+	}{
+		{model.BPStandardACCAHA, 119, 79, "Normal"},
+		{model.BPStandardACCAHA, 120, 79, "Elevated"},
+		{model.BPStandardACCAHA, 129, 79, "Elevated"},
+		{model.BPStandardACCAHA, 130, 79, "Hypertension Stage 1"},
+		{model.BPStandardACCAHA, 119, 80, "Hypertension Stage 1"},
+		{model.BPStandardACCAHA, 139, 89, "Hypertension Stage 1"},
+		{model.BPStandardACCAHA, 140, 89, "Hypertension Stage 2"},
+		{model.BPStandardACCAHA, 139, 90, "Hypertension Stage 2"},
+		{model.BPStandardACCAHA, 180, 120, "Hypertension Stage 2"},
+		{model.BPStandardACCAHA, 181, 120, "Hypertensive Crisis"},
+		{model.BPStandardACCAHA, 180, 121, "Hypertensive Crisis"},
+		{"", 120, 79, "Elevated"}, // ACC/AHA is the default
+
+		{model.BPStandardESC, 119, 79, "Optimal"},
+		{model.BPStandardESC, 120, 79, "Normal"},
+		{model.BPStandardESC, 119, 80, "Normal"},
+		{model.BPStandardESC, 130, 84, "High Normal"},
+		{model.BPStandardESC, 129, 85, "High Normal"},
+		{model.BPStandardESC, 140, 89, "Grade 1 Hypertension"},
+		{model.BPStandardESC, 139, 90, "Grade 1 Hypertension"},
+		{model.BPStandardESC, 160, 99, "Grade 2 Hypertension"},
+		{model.BPStandardESC, 159, 100, "Grade 2 Hypertension"},
+		{model.BPStandardESC, 180, 109, "Grade 3 Hypertension"},
+		{model.BPStandardESC, 179, 110, "Grade 3 Hypertension"},
+
+		{model.BPStandardJNC7, 119, 79, "Normal"},
+		{model.BPStandardJNC7, 120, 79, "Prehypertension"},
+		{model.BPStandardJNC7, 119, 80, "Prehypertension"},
+		{model.BPStandardJNC7, 140, 89, "Hypertension Stage 1"},
+		{model.BPStandardJNC7, 139, 90, "Hypertension Stage 1"},
+		{model.BPStandardJNC7, 160, 99, "Hypertension Stage 2"},
+		{model.BPStandardJNC7, 159, 100, "Hypertension Stage 2"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d/%d", tt.standard, tt.systolic, tt.diastolic), func(t *testing.T) {
+			if got := getBPCategory(tt.standard, tt.systolic, tt.diastolic); got != tt.want {
+				t.Errorf("getBPCategory = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccAHABPCategoryMixedReadings(t *testing.T) {
+	// Pairs whose systolic and diastolic fall in different categories used to
+	// match no branch and come back Unknown
+	tests := []struct {
+		systolic, diastolic int
+		want                string
+	}{
+		{125, 85, "Hypertension Stage 1"},
+		{115, 85, "Hypertension Stage 1"},
+		{135, 75, "Hypertension Stage 1"},
+		{125, 95, "Hypertension Stage 2"},
+		{145, 70, "Hypertension Stage 2"},
+		{129, 80, "Hypertension Stage 1"},
+		{120, 0, "Elevated"},
+		{0, 0, "Normal"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d", tt.systolic, tt.diastolic), func(t *testing.T) {
+			if got := accAHABPCategory(tt.systolic, tt.diastolic); got != tt.want {
+				t.Errorf("accAHABPCategory = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBPCategoryNeverUnknown(t *testing.T) {
+	for _, standard := range []model.BPStandard{model.BPStandardACCAHA, model.BPStandardESC, model.BPStandardJNC7} {
+		for systolic := 60; systolic <= 250; systolic++ {
+			for diastolic := 30; diastolic <= 150; diastolic++ {
+				if got := getBPCategory(standard, systolic, diastolic); got == "" || got == "Unknown" {
+					t.Fatalf("%s %d/%d has no category", standard, systolic, diastolic)
+				}
+			}
+		}
+	}
+}
+
+func TestBuildPoints(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 8, 0, 15, 123456789, time.UTC)
+	tests := []struct {
+		name        string
+		metric      model.Metric
+		precision   model.Precision
+		want        model.Metric
+		wantSkipped int
+		wantErrors  int
+	}{
+		{
+			name: "typed fields",
+			metric: model.Metric{
+				Measurement: "workout",
+				Tags:        map[string]string{"source": "Watch", "workout_id": "w1"},
+				Fields: map[string]interface{}{
+					"name": "Running", "distance": 5.2, "duration": 1800.0, "steps": int64(5400),
+					"laps": 4, "indoor": false,
+				},
+				FieldTypes: map[string]model.FieldType{"duration": model.FieldTypeInteger},
+				Timestamp:  ts,
+			},
+			want: model.Metric{
+				Measurement: "workout",
+				Tags:        map[string]string{"source": "Watch", "workout_id": "w1"},
+				Fields: map[string]interface{}{
+					"name": "Running", "distance": 5.2, "duration": int64(1800), "steps": int64(5400),
+					"laps": int64(4), "indoor": false,
+				},
+				Timestamp: ts,
+			},
+		},
+		{
+			name:      "second precision truncates",
+			metric:    model.Metric{Measurement: "heart_rate", Fields: map[string]interface{}{"value": 62.0}, Timestamp: ts},
+			precision: model.PrecisionSecond,
+			want:      model.Metric{Measurement: "heart_rate", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 62.0}, Timestamp: ts.Truncate(time.Second)},
+		},
+		{
+			name:      "millisecond precision truncates",
+			metric:    model.Metric{Measurement: "heart_rate", Fields: map[string]interface{}{"value": 62.0}, Timestamp: ts},
+			precision: model.PrecisionMillisecond,
+			want:      model.Metric{Measurement: "heart_rate", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 62.0}, Timestamp: ts.Truncate(time.Millisecond)},
+		},
+		{
+			name:   "no timestamp leaves the line unstamped",
+			metric: model.Metric{Measurement: "heart_rate", Fields: map[string]interface{}{"value": 62.0}},
+			want:   model.Metric{Measurement: "heart_rate", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 62.0}},
+		},
+		{
+			name: "unsupported field is dropped",
+			metric: model.Metric{Measurement: "meal", Timestamp: ts, Fields: map[string]interface{}{
+				"calories": 450.0, "items": []interface{}{"toast"},
+			}},
+			want:       model.Metric{Measurement: "meal", Tags: map[string]string{}, Fields: map[string]interface{}{"calories": 450.0}, Timestamp: ts},
+			wantErrors: 1,
+		},
+		{
+			name:        "no supported fields is skipped",
+			metric:      model.Metric{Measurement: "meal", Fields: map[string]interface{}{"items": map[string]interface{}{}}},
+			wantSkipped: 1,
+			wantErrors:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lpPrecision := lineProtocolPrecision(tt.precision)
+			points, result := buildPoints([]model.Metric{tt.metric}, lpPrecision)
+			if result.Skipped != tt.wantSkipped || len(result.Errors) != tt.wantErrors {
+				t.Fatalf("skipped %d with errors %q, want %d skipped and %d errors", result.Skipped, result.Errors, tt.wantSkipped, tt.wantErrors)
+			}
+			if tt.wantSkipped > 0 {
+				if len(points) != 0 || result.Written != 0 {
+					t.Errorf("wrote %d points, want none", len(points))
+				}
+				return
+			}
+			if len(points) != 1 || result.Written != 1 {
+				t.Fatalf("wrote %d points, want 1", len(points))
+			}
+			line, err := points[0].MarshalBinary(lpPrecision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := decodeLine(t, line, lpPrecision)
+			if got.Measurement != tt.want.Measurement || !maps.Equal(got.Tags, tt.want.Tags) || !maps.Equal(got.Fields, tt.want.Fields) {
+				t.Errorf("encoded %+v, want %+v", got, tt.want)
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+		})
+	}
+}
+
+func TestGroupWorkoutWeeks(t *testing.T) {
+	at := func(date string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", date)
+		return t
+	}
+	tests := []struct {
+		name     string
+		workouts []startedWorkout
+		want     []model.WorkoutWeek
+	}{
+		{name: "none", want: []model.WorkoutWeek{}},
+		{
+			name: "Sunday closes the ISO week",
+			workouts: []startedWorkout{
+				{start: at("2024-03-04 07:00"), workout: model.Workout{Duration: 30, Calories: 300}},
+				{start: at("2024-03-10 21:30"), workout: model.Workout{Duration: 45, Calories: 400}},
+				{start: at("2024-03-11 06:15"), workout: model.Workout{Duration: 20, Calories: 150}},
+			},
+			want: []model.WorkoutWeek{
+				{Week: "2024-W10", StartDate: "2024-03-04", Duration: 75, Calories: 700, Count: 2},
+				{Week: "2024-W11", StartDate: "2024-03-11", Duration: 20, Calories: 150, Count: 1},
+			},
+		},
+		{
+			name: "week spanning the new year",
+			workouts: []startedWorkout{
+				{start: at("2024-12-31 18:00"), workout: model.Workout{Duration: 40, Calories: 350}},
+			},
+			want: []model.WorkoutWeek{{Week: "2025-W01", StartDate: "2024-12-30", Duration: 40, Calories: 350, Count: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupWorkoutWeeks(tt.workouts); !slices.Equal(got, tt.want) {
+				t.Errorf("groupWorkoutWeeks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkoutNumber(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  float64
+	}{
+		{name: "int64", value: int64(1800), want: 1800},
+		{name: "float64", value: 1800.0, want: 1800},
+		{name: "fractional float64", value: 312.7, want: 312.7},
+		{name: "missing", value: nil, want: 0},
+		{name: "string", value: "1800", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workoutNumber(tt.value); got != tt.want {
+				t.Errorf("workoutNumber(%#v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkoutFromRecordFloatColumns(t *testing.T) {
+	record := map[string]interface{}{
+		"workout_id":          "swim-1",
+		"start_time":          time.Date(2024, 3, 5, 6, 30, 0, 0, time.UTC),
+		"workout_name":        "Swimming",
+		"duration":            2730.0,
+		"active_energy_value": 412.5,
+	}
+	got := (&InfluxDBStore{}).workoutFromRecord(record, timeFormat{loc: time.UTC})
+	if got.Duration != 45 || got.Calories != 412.5 {
+		t.Errorf("duration = %d min, calories = %v; want 45 min and 412.5", got.Duration, got.Calories)
+	}
+}
+
+func TestBuildDietaryTrendsForwardFillsLeadIn(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	intake := func(calories float64) *dailyNutrient {
+		return &dailyNutrient{calories: calories, protein: calories / 20}
+	}
+	tests := []struct {
+		name       string
+		dailyData  map[string]*dailyNutrient
+		wantTrends []float64 // Calorie trend for Mar 10–12
+	}{
+		{
+			name: "lead-in only",
+			dailyData: map[string]*dailyNutrient{
+				"2024-03-03": intake(2000), "2024-03-04": intake(2200), "2024-03-05": intake(2400),
+			},
+			wantTrends: []float64{2200, 2200, 2200},
+		},
+		{
+			name: "lead-in then a logged day",
+			dailyData: map[string]*dailyNutrient{
+				"2024-03-04": intake(2000), "2024-03-06": intake(2000), "2024-03-08": intake(2000),
+				"2024-03-11": intake(2800),
+			},
+			wantTrends: []float64{2000, 2200, 2200},
+		},
+		{
+			name: "too little lead-in to trend",
+			dailyData: map[string]*dailyNutrient{
+				"2024-03-05": intake(2000), "2024-03-06": intake(2000),
+			},
+			wantTrends: []float64{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trends := buildDietaryTrends(tt.dailyData, day(10), day(12), 7, timeFormat{loc: time.UTC})
+			if len(trends) != len(tt.wantTrends) {
+				t.Fatalf("got %d days, want %d", len(trends), len(tt.wantTrends))
+			}
+			if trends[0].Date != "Mar 10" {
+				t.Errorf("first day = %q, want Mar 10", trends[0].Date)
+			}
+			for i, trend := range trends {
+				if trend.Trend != tt.wantTrends[i] {
+					t.Errorf("%s trend = %v, want %v", trend.Date, trend.Trend, tt.wantTrends[i])
+				}
+				if trend.ProteinTrend != tt.wantTrends[i]/20 {
+					t.Errorf("%s protein trend = %v, want %v", trend.Date, trend.ProteinTrend, tt.wantTrends[i]/20)
+				}
+			}
+		})
+	}
+}
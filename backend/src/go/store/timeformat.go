@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"health_app/api/model"
+)
+
+// timeFormat renders the timestamps of one response in the zone chosen by the
+// request's tz param. Day boundaries always follow the server's APP_TIMEZONE;
+// only the rendering changes.
+type timeFormat struct {
+	loc *time.Location
+	utc bool
+}
+
+// timeFormat returns the rendering requested in ctx, defaulting to display
+// labels in the server's APP_TIMEZONE
+func (s *InfluxDBStore) timeFormat(ctx context.Context) timeFormat {
+	tz := model.TimezoneFromContext(ctx)
+	if tz.Location != nil {
+		return timeFormat{loc: tz.Location, utc: tz.UTC}
+	}
+	return timeFormat{loc: s.loc, utc: tz.UTC}
+}
+
+// instant renders a reading's time with layout, or as an ISO 8601 UTC
+// timestamp for tz=utc
+func (f timeFormat) instant(t time.Time, layout string) string {
+	if f.utc {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return t.In(f.loc).Format(layout)
+}
+
+// day renders a local calendar day with layout, or as YYYY-MM-DD for tz=utc
+func (f timeFormat) day(d time.Time, layout string) string {
+	if f.utc {
+		return d.Format("2006-01-02")
+	}
+	return d.Format(layout)
+}
+
+// in converts t to the response's zone for fields marshalled as time.Time
+func (f timeFormat) in(t time.Time) time.Time {
+	if f.utc {
+		return t.UTC()
+	}
+	return t.In(f.loc)
+}
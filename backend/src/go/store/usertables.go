@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
+	"health_app/api/model"
+)
+
+// userTablesTTL bounds how stale the cached list of user_id-tagged tables can
+// get; every successful write also clears it
+const userTablesTTL = time.Minute
+
+// userTables returns the measurements that have a user_id column. Tables
+// written before per-user isolation have none and hold no user's rows.
+func (s *InfluxDBStore) userTables(ctx context.Context) (map[string]bool, error) {
+	s.userTablesMu.Lock()
+	defer s.userTablesMu.Unlock()
+	if s.userTablesCache != nil && time.Since(s.userTablesAt) < userTablesTTL {
+		return s.userTablesCache, nil
+	}
+
+	sqlQuery := `
+SELECT table_name
+FROM information_schema.columns
+WHERE table_schema = 'iox' AND column_name = $column`
+
+	// The lookup itself spans every user's tables, so it runs unscoped
+	result, err := s.query(model.WithUserID(ctx, ""), sqlQuery, influxdb3.QueryParameters{"column": model.UserIDTag})
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool)
+	for result.Next() {
+		if name, ok := result.Value()["table_name"].(string); ok {
+			tables[name] = true
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	s.userTablesCache, s.userTablesAt = tables, time.Now()
+	return tables, nil
+}
+
+// forgetUserTables drops the cached user tables so a write that added a
+// user_id column is seen by the next query
+func (s *InfluxDBStore) forgetUserTables() {
+	s.userTablesMu.Lock()
+	defer s.userTablesMu.Unlock()
+	s.userTablesCache = nil
+}
+
+// userMeasurements lists the measurements holding at least one of the
+// request user's points, in name order
+func (s *InfluxDBStore) userMeasurements(ctx context.Context) ([]string, error) {
+	tables, err := s.userTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return []string{}, nil
+	}
+
+	// One probe per table, each rewritten by scopeToUser to the user's rows
+	probes := make([]string, len(names))
+	for i, name := range names {
+		probes[i] = fmt.Sprintf(`(SELECT '%s' AS table_name FROM "%s" LIMIT 1)`,
+			strings.ReplaceAll(name, "'", "''"), name)
+	}
+	sqlQuery := "SELECT DISTINCT table_name FROM (" + strings.Join(probes, "\nUNION ALL\n") + ") AS probes ORDER BY table_name ASC"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	result, err := s.query(ctx, sqlQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	measurements := []string{}
+	for result.Next() {
+		if name, ok := result.Value()["table_name"].(string); ok {
+			measurements = append(measurements, name)
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	return measurements, nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"health_app/api/model"
+)
+
+// vitalSeries maps a generic vital name to the measurement field it reads
+type vitalSeries struct {
+	measurement string
+	field       string
+	window      func(w windowConfig) int // Default range in days
+	fields      []string                 // Allowlist for ?fields=; nil allows only field
+	layout      string                   // Time label layout; "Jan 02" when empty
+}
+
+// vitalRegistry lists the vitals served by /api/v1/vitals/{metric}
+var vitalRegistry = map[string]vitalSeries{
+	"hr":          {"heart_rate", "avg", func(w windowConfig) int { return w.HRDaily }, []string{"avg", "min", "max"}, "Jan 02 15:04"},
+	"resting-hr":  {"resting_heart_rate", "qty", func(w windowConfig) int { return w.RestingHR }, nil, ""},
+	"hrv":         {"heart_rate_variability", "qty", func(w windowConfig) int { return w.HRV }, nil, ""},
+	"spo2":        {"blood_oxygen", "qty", func(w windowConfig) int { return w.Spo2 }, nil, ""},
+	"respiratory": {"respiratory_rate", "qty", func(w windowConfig) int { return w.RespiratoryRate }, nil, ""},
+	"vo2max":      {"vo2_max", "qty", func(w windowConfig) int { return w.VO2Max }, nil, ""},
+	"glucose":     {"blood_glucose", "qty", func(w windowConfig) int { return w.Glucose }, nil, ""},
+	"systolic":    {"blood_pressure", "systolic", func(w windowConfig) int { return w.BloodPressure }, []string{"systolic", "diastolic"}, ""},
+	"diastolic":   {"blood_pressure", "diastolic", func(w windowConfig) int { return w.BloodPressure }, []string{"systolic", "diastolic"}, ""},
+	"temperature": {"body_temperature", "qty", func(w windowConfig) int { return w.BodyTemperature }, nil, ""},
+}
+
+// allows reports whether field may be requested for the vital
+func (v vitalSeries) allows(field string) bool {
+	if v.fields == nil {
+		return field == v.field
+	}
+	return slices.Contains(v.fields, field)
+}
+
+// GetVital returns the raw readings of a registered vital, or model.ErrNotFound
+// for a name missing from vitalRegistry
+func (s *InfluxDBStore) GetVital(ctx context.Context, metric, startDate, endDate string) ([]model.TimeSeriesValue, error) {
+	vital, ok := vitalRegistry[metric]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	series, err := s.GetVitalFields(ctx, metric, []string{vital.field}, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return series[vital.field], nil
+}
+
+// GetVitalFields returns a series per requested field of a registered vital.
+// It returns model.ErrNotFound for an unknown vital and wraps
+// model.ErrUnknownField for a field outside the vital's allowlist.
+func (s *InfluxDBStore) GetVitalFields(ctx context.Context, metric string, fields []string, startDate, endDate string) (map[string][]model.TimeSeriesValue, error) {
+	vital, ok := vitalRegistry[metric]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		if !vital.allows(field) {
+			return nil, fmt.Errorf("%w %q for vital %q", model.ErrUnknownField, field, metric)
+		}
+		columns[i] = fmt.Sprintf(`"%s"`, field)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tf := s.timeFormat(ctx)
+	layout := vital.layout
+	if layout == "" {
+		layout = "Jan 02"
+	}
+	start, stop := getRangeUTC(startDate, endDate, vital.window(s.windows), s.loc)
+	// Names come from the registry, never the request, so formatting them in is safe
+	sqlQuery := fmt.Sprintf(`
+SELECT time, %s
+FROM "%s"
+WHERE time > $start AND time <= $stop
+ORDER BY time ASC`, strings.Join(columns, ", "), vital.measurement)
+
+	result, err := s.query(ctx, sqlQuery, rangeParams(start, stop))
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string][]model.TimeSeriesValue, len(fields))
+	for _, field := range fields {
+		series[field] = []model.TimeSeriesValue{}
+	}
+	for result.Next() {
+		record := result.Value()
+		t, okTime := record["time"].(time.Time)
+		if !okTime {
+			continue
+		}
+		for _, field := range fields {
+			// Integer fields (e.g. blood pressure) come back as int64
+			var value float64
+			switch v := record[field].(type) {
+			case float64:
+				value = v
+			case int64:
+				value = float64(v)
+			default:
+				continue
+			}
+			series[field] = append(series[field], model.TimeSeriesValue{
+				Time:  tf.instant(t, layout),
+				Value: value,
+			})
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return series, nil
+}